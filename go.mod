@@ -1,6 +1,6 @@
 module github.com/adnan-mansoor-2015/obelisk
 
-go 1.16
+go 1.18
 
 require (
 	github.com/skycoin/skycoin v0.27.1
@@ -5,7 +5,10 @@
 package consensus
 
 import (
+	"bytes"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/skycoin/skycoin/src/cipher"
 )
@@ -33,8 +36,19 @@ var Cfg_consensus_waiting_time_as_seqno_diff uint64 = 7
 
 // How many (hash,signer_pubkey) pairs to acquire for decision-making.
 // This also limits forwarded traffic, because the messages in excess
-// of this limit are discarded hence not forwarded:
-//var Cfg_consensus_max_candidate_messages = 10
+// of this limit are discarded hence not forwarded. Signers in excess
+// are still counted, and a hash first seen in excess of this limit
+// keeps that one signature, so the best hash does not depend on
+// arrival order:
+var Cfg_consensus_max_candidate_messages int = 10
+
+// Whether participants that have a Signer endorse candidates with a
+// signed vote of their own (once per seqno):
+var Cfg_consensus_cast_votes bool = true
+
+// The weight of a signer, to choose between candidate hashes with as
+// many signers each. nil gives every signer a weight of 1:
+var Cfg_consensus_signer_weight func(pubkey cipher.PubKey) uint64 = nil
 
 //
 ////////////////////////////////////////////////////////////////////////////////
@@ -91,20 +105,36 @@ type BlockchainTail struct {
 	blockPtr_slice []*BlockBase
 	// This is for a lookup of content
 	hash_to_blockPtr_map map[cipher.SHA256]*BlockBase
+	// The signatures that got each block committed, if known. Needed
+	// for comparing with other participants' commits.
+	hash_to_sigs_map map[cipher.SHA256][]cipher.Sig
+	// How many distinct signers supported each block, which can be more
+	// than the signatures kept:
+	hash_to_support_map map[cipher.SHA256]int
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 func (self *BlockchainTail) Init() {
 	self.hash_to_blockPtr_map = make(map[cipher.SHA256]*BlockBase)
+	self.hash_to_sigs_map = make(map[cipher.SHA256][]cipher.Sig)
+	self.hash_to_support_map = make(map[cipher.SHA256]int)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
+// Validates blockPtr_slice and hash_to_blockPtr_map against each other,
+// and that the seqnos in blockPtr_slice are contiguous.
 func (self *BlockchainTail) is_consistent() bool {
-	// TODO Validate
-	//    blockPtr_slice
-	// and
-	//    hash_to_blockPtr_map
-	// against each other
+	if len(self.hash_to_blockPtr_map) != len(self.blockPtr_slice) {
+		return false
+	}
+	for i, blockPtr := range self.blockPtr_slice {
+		if self.hash_to_blockPtr_map[blockPtr.Hash] != blockPtr {
+			return false
+		}
+		if i > 0 && blockPtr.Seqno != self.blockPtr_slice[i-1].Seqno+1 {
+			return false
+		}
+	}
 	return true
 }
 
@@ -115,6 +145,8 @@ func (self *BlockchainTail) append_nocheck(blockPtr *BlockBase) {
 		// Trim the size:
 		b0p := self.blockPtr_slice[0]
 		delete(self.hash_to_blockPtr_map, b0p.Hash) // pop 1 of 2
+		delete(self.hash_to_sigs_map, b0p.Hash)
+		delete(self.hash_to_support_map, b0p.Hash)
 		b0p = nil
 		self.blockPtr_slice[0] = nil
 		self.blockPtr_slice = self.blockPtr_slice[1:] // pop 2 of 2
@@ -164,6 +196,70 @@ func (self *BlockchainTail) try_append_to_BlockchainTail(blockPtr *BlockBase) in
 	return 0 // Inserted
 }
 
+////////////////////////////////////////////////////////////////////////////////
+func (self *BlockchainTail) set_sigs(hash cipher.SHA256, sigs []cipher.Sig) {
+	if _, have := self.hash_to_blockPtr_map[hash]; have {
+		self.hash_to_sigs_map[hash] = sigs
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *BlockchainTail) get_sigs(hash cipher.SHA256) []cipher.Sig {
+	return self.hash_to_sigs_map[hash]
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *BlockchainTail) set_support(hash cipher.SHA256, support int) {
+	if _, have := self.hash_to_blockPtr_map[hash]; have {
+		self.hash_to_support_map[hash] = support
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Returns the number of distinct signers of the block, or of its
+// signatures if that is not known.
+func (self *BlockchainTail) get_support(hash cipher.SHA256) int {
+	if support, have := self.hash_to_support_map[hash]; have {
+		return support
+	}
+	return len(self.hash_to_sigs_map[hash])
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Returns nil if the block at 'seqno' is not (or no longer) held.
+func (self *BlockchainTail) get_block_at(seqno uint64) *BlockBase {
+	n := len(self.blockPtr_slice)
+	if n == 0 {
+		return nil
+	}
+	first := self.blockPtr_slice[0].Seqno
+	if seqno < first || seqno >= first+uint64(n) {
+		return nil
+	}
+	return self.blockPtr_slice[seqno-first]
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Removes the blocks with seqno >= 'seqno' and returns them, oldest first.
+func (self *BlockchainTail) rollback_from(seqno uint64) []*BlockBase {
+	n := len(self.blockPtr_slice)
+	i := n
+	for i > 0 && self.blockPtr_slice[i-1].Seqno >= seqno {
+		i--
+	}
+
+	removed := append([]*BlockBase(nil), self.blockPtr_slice[i:]...)
+	for j := i; j < n; j++ {
+		delete(self.hash_to_blockPtr_map, self.blockPtr_slice[j].Hash)
+		delete(self.hash_to_sigs_map, self.blockPtr_slice[j].Hash)
+		delete(self.hash_to_support_map, self.blockPtr_slice[j].Hash)
+		self.blockPtr_slice[j] = nil
+	}
+	self.blockPtr_slice = self.blockPtr_slice[:i]
+
+	return removed
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 func (self *BlockchainTail) GetNextSeqNo() uint64 {
 	n := len(self.blockPtr_slice)
@@ -193,12 +289,18 @@ func (self *BlockchainTail) Print() {
 type HashCandidate struct {
 	pubkey2sig map[cipher.PubKey]cipher.Sig // Primary data
 	sig2none   map[cipher.Sig]byte          // Lookup without (expensive) pubkey recovery
+
+	// Signers seen after Cfg_consensus_max_candidate_messages was
+	// reached, other than the first one of a hash new by then. They
+	// count towards the support, but their signatures are not kept:
+	late_pubkey2none map[cipher.PubKey]byte
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 func (self *HashCandidate) Init() {
 	self.pubkey2sig = make(map[cipher.PubKey]cipher.Sig)
 	self.sig2none = make(map[cipher.Sig]byte)
+	self.late_pubkey2none = make(map[cipher.PubKey]byte)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -228,6 +330,36 @@ func (self *HashCandidate) ObserveSigAndPubkey(
 
 }
 
+////////////////////////////////////////////////////////////////////////////////
+func (self *HashCandidate) ObserveLatePubkey(pubkey cipher.PubKey) {
+	if _, have := self.pubkey2sig[pubkey]; !have {
+		self.late_pubkey2none[pubkey] = byte('1')
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// The number of distinct signers, including the late ones.
+func (self *HashCandidate) Support() int {
+	return len(self.pubkey2sig) + len(self.late_pubkey2none)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// The total weight of the signers, including the late ones, see
+// Cfg_consensus_signer_weight.
+func (self *HashCandidate) Weight() uint64 {
+	if Cfg_consensus_signer_weight == nil {
+		return uint64(self.Support())
+	}
+	var weight uint64
+	for pubkey, _ := range self.pubkey2sig {
+		weight += Cfg_consensus_signer_weight(pubkey)
+	}
+	for pubkey, _ := range self.late_pubkey2none {
+		weight += Cfg_consensus_signer_weight(pubkey)
+	}
+	return weight
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 func (self *HashCandidate) Clear() {
 	for i, _ := range self.pubkey2sig {
@@ -236,6 +368,9 @@ func (self *HashCandidate) Clear() {
 	for i, _ := range self.sig2none {
 		delete(self.sig2none, i)
 	}
+	for i, _ := range self.late_pubkey2none {
+		delete(self.late_pubkey2none, i)
+	}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -255,3 +390,362 @@ func (self *HashCandidate) is_consistent() bool {
 }
 
 ////////////////////////////////////////////////////////////////////////////////
+//
+// BlockStat accumulates the (hash,signature) pairs observed for one
+// seqno until it is ripe for deciding which hash goes to BlockchainTail.
+//
+////////////////////////////////////////////////////////////////////////////////
+type BlockStat struct {
+	// Candidate hashes for this seqno and who signed each of them.
+	hash2info map[cipher.SHA256]*HashCandidate
+
+	seqno  uint64
+	frozen bool // No more updates once moved to BlockchainTail
+
+	first_seen time.Time // When the first candidate arrived, for metrics
+
+	accept_count        int
+	debug_reject_count  int
+	debug_neglect_count int
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *BlockStat) Init() {
+	self.hash2info = make(map[cipher.SHA256]*HashCandidate)
+	self.Clear()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *BlockStat) Clear() {
+	for i, _ := range self.hash2info {
+		delete(self.hash2info, i)
+	}
+	self.seqno = 0
+	self.frozen = false
+	self.first_seen = time.Time{}
+	self.accept_count = 0
+	self.debug_reject_count = 0
+	self.debug_neglect_count = 0
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Return codes: 0 = added, 1 = duplicate (hash,pubkey) or (hash,sig),
+// 2 = enough messages for this seqno, 3 = frozen, 4 = invalid hash or
+// signature.
+func (self *BlockStat) try_add_hash_and_sig(
+	hash cipher.SHA256,
+	sig cipher.Sig) int {
+
+	if self.frozen {
+		// To get a more accurate count of what arrives when it is
+		// already too late:
+		self.debug_neglect_count += 1
+		return 3
+	}
+
+	if self.accept_count >= Cfg_consensus_max_candidate_messages {
+		self.debug_neglect_count += 1
+		self.observe_late_sig(hash, sig)
+		return 2
+	}
+
+	// Null hashes can't be signed, but pubkey recovery does not
+	// always reject them:
+	if hash == (cipher.SHA256{}) {
+		self.debug_reject_count += 1
+		return 4
+	}
+
+	info, have_hash := self.hash2info[hash]
+	if have_hash {
+		// Cheap lookup first, to avoid the (expensive) pubkey recovery:
+		if _, have_sig := info.sig2none[sig]; have_sig {
+			self.debug_reject_count += 1
+			return 1
+		}
+	}
+
+	// PERFORMANCE: This is expensive:
+	signer_pubkey, err := cipher.PubKeyFromSig(sig, hash)
+	if err != nil {
+		self.debug_reject_count += 1
+		return 4
+	}
+
+	if have_hash {
+		// Same signer, same hash, but a (non-deterministically)
+		// different signature:
+		if _, have_pubkey := info.pubkey2sig[signer_pubkey]; have_pubkey {
+			self.debug_reject_count += 1
+			return 1
+		}
+	} else {
+		info = &HashCandidate{}
+		info.Init()
+		self.hash2info[hash] = info
+	}
+
+	info.ObserveSigAndPubkey(sig, signer_pubkey)
+	self.accept_count += 1
+
+	return 0
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// A message in excess of Cfg_consensus_max_candidate_messages is not
+// kept, but its signer still counts towards the support of its hash, see
+// HashCandidate::Support(). A hash first seen here becomes a candidate
+// with this one signature, so that it can be committed with a valid one.
+func (self *BlockStat) observe_late_sig(hash cipher.SHA256, sig cipher.Sig) {
+	if hash == (cipher.SHA256{}) {
+		return
+	}
+
+	info, have_hash := self.hash2info[hash]
+	if have_hash {
+		if _, have_sig := info.sig2none[sig]; have_sig {
+			return
+		}
+	}
+
+	// PERFORMANCE: This is expensive:
+	pubkey, err := cipher.PubKeyFromSig(sig, hash)
+	if err != nil {
+		return
+	}
+
+	if have_hash {
+		info.ObserveLatePubkey(pubkey)
+	} else {
+		info = &HashCandidate{}
+		info.Init()
+		self.hash2info[hash] = info
+		info.ObserveSigAndPubkey(sig, pubkey)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Whether candidate 'hash_a' beats candidate 'hash_b': more distinct
+// signers first, then more total weight, then the smaller hash. The rule
+// does not depend on arrival order, so that participants that observed
+// the same votes commit the same block.
+func is_better_candidate(
+	hash_a cipher.SHA256,
+	info_a *HashCandidate,
+	hash_b cipher.SHA256,
+	info_b *HashCandidate) bool {
+
+	n_a, n_b := info_a.Support(), info_b.Support()
+	if n_a != n_b {
+		return n_a > n_b
+	}
+	w_a, w_b := info_a.Weight(), info_b.Weight()
+	if w_a != w_b {
+		return w_a > w_b
+	}
+	return bytes.Compare(hash_a[:], hash_b[:]) < 0
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Returns the best hash, see is_better_candidate(), together with the
+// (pubkey,sig) pair of its signer with the smallest pubkey, of those
+// whose signatures were kept.
+func (self *BlockStat) GetBestHashPubkeySig() (
+	cipher.SHA256,
+	cipher.PubKey,
+	cipher.Sig) {
+
+	var best_hash cipher.SHA256
+	var best_pubkey cipher.PubKey
+	var best_sig cipher.Sig
+	var best_info *HashCandidate
+
+	for hash, info := range self.hash2info {
+		if best_info == nil ||
+			is_better_candidate(hash, info, best_hash, best_info) {
+			best_hash, best_info = hash, info
+		}
+	}
+	if best_info == nil {
+		return best_hash, best_pubkey, best_sig
+	}
+
+	first := true
+	for pubkey, sig := range best_info.pubkey2sig {
+		if first || bytes.Compare(pubkey[:], best_pubkey[:]) < 0 {
+			best_pubkey, best_sig = pubkey, sig
+			first = false
+		}
+	}
+
+	return best_hash, best_pubkey, best_sig
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Returns the signatures observed for 'hash', smallest first.
+func (self *BlockStat) get_sigs_of(hash cipher.SHA256) []cipher.Sig {
+	info, have := self.hash2info[hash]
+	if !have {
+		return nil
+	}
+	sigs := make([]cipher.Sig, 0, len(info.pubkey2sig))
+	for _, sig := range info.pubkey2sig {
+		sigs = append(sigs, sig)
+	}
+	sort.Slice(sigs, func(i, j int) bool {
+		return bytes.Compare(sigs[i][:], sigs[j][:]) < 0
+	})
+	return sigs
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Returns the number of distinct signers observed for 'hash'.
+func (self *BlockStat) get_support_of(hash cipher.SHA256) int {
+	info, have := self.hash2info[hash]
+	if !have {
+		return 0
+	}
+	return info.Support()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *BlockStat) Print() {
+	fmt.Printf("BlockStat={seqno=%d,frozen=%t,accept_count=%d,"+
+		"reject_count=%d,neglect_count=%d,hash2info={",
+		self.seqno, self.frozen, self.accept_count,
+		self.debug_reject_count, self.debug_neglect_count)
+
+	first := true
+	for hash, info := range self.hash2info {
+		if !first {
+			fmt.Print(",")
+		}
+		first = false
+		fmt.Printf("%s:%d", hash.Hex()[:8], len(info.pubkey2sig))
+	}
+	fmt.Printf("}}")
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// BlockStatQueue holds the BlockStat entries ordered by increasing seqno.
+//
+////////////////////////////////////////////////////////////////////////////////
+type BlockStatQueue struct {
+	queue []*BlockStat
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *BlockStatQueue) Len() int {
+	return len(self.queue)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// The seqnos the queue accepts: from the oldest BlockStat we keep up to
+// Cfg_consensus_candidate_max_seqno_gap past the newest one. 'ok' is false
+// if the queue is empty, in which case any seqno is accepted.
+func (self *BlockStatQueue) get_seqno_window() (low uint64, high uint64, ok bool) {
+	n := len(self.queue)
+	if n == 0 {
+		return 0, 0, false
+	}
+	return self.queue[0].seqno,
+		self.queue[n-1].seqno + Cfg_consensus_candidate_max_seqno_gap, true
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Return codes: those of BlockStat.try_add_hash_and_sig(), plus
+// 5 = seqno is older than the oldest BlockStat we keep,
+// 6 = seqno is too far ahead of the newest one.
+func (self *BlockStatQueue) try_append_to_BlockStatQueue(
+	blockPtr *BlockBase) int {
+
+	seqno := blockPtr.Seqno
+	n := len(self.queue)
+
+	if low, high, ok := self.get_seqno_window(); ok {
+		if seqno < low {
+			return 5 // SeqNo too low
+		}
+		if seqno > high {
+			return 6 // SeqNo too high
+		}
+	}
+
+	// Find the place to insert, or the existing entry to update:
+	i := n
+	for i > 0 && self.queue[i-1].seqno >= seqno {
+		i--
+	}
+	if i < n && self.queue[i].seqno == seqno {
+		return self.queue[i].try_add_hash_and_sig(blockPtr.Hash, blockPtr.Sig)
+	}
+
+	statPtr := &BlockStat{}
+	statPtr.Init()
+	statPtr.seqno = seqno
+
+	res := statPtr.try_add_hash_and_sig(blockPtr.Hash, blockPtr.Sig)
+	if res != 0 {
+		return res // Do not keep BlockStat entries that have no votes
+	}
+
+	self.queue = append(self.queue, nil)
+	copy(self.queue[i+1:], self.queue[i:])
+	self.queue[i] = statPtr
+
+	return 0
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Removes the frozen BlockStat entries at the front of the queue whose seqno
+// is below 'seqno'. Stops at the first entry that is not frozen, so votes
+// still being counted are never lost.
+func (self *BlockStatQueue) drop_frozen_before(seqno uint64) {
+	i := 0
+	for i < len(self.queue) &&
+		self.queue[i].frozen && self.queue[i].seqno < seqno {
+		self.queue[i] = nil
+		i++
+	}
+	self.queue = self.queue[i:]
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Returns nil if there is no BlockStat for 'seqno'.
+func (self *BlockStatQueue) find_BlockStat(seqno uint64) *BlockStat {
+	for i := len(self.queue) - 1; i >= 0; i-- {
+		if self.queue[i].seqno == seqno {
+			return self.queue[i]
+		}
+		if self.queue[i].seqno < seqno {
+			break
+		}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *BlockStatQueue) Print() {
+	n := len(self.queue)
+	fmt.Printf("BlockStatQueue={n=%d", n)
+
+	for i := 0; i < n; i++ {
+		fmt.Print(",")
+		self.queue[i].Print()
+	}
+	fmt.Printf("}")
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// ConnectionManagerInterface is what ConsensusParticipant needs from the
+// networking layer.
+//
+////////////////////////////////////////////////////////////////////////////////
+type ConnectionManagerInterface interface {
+	Print()
+	SendBlockToAllMySubscriber(blockPtr *BlockBase)
+}
+
+////////////////////////////////////////////////////////////////////////////////
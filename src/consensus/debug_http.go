@@ -0,0 +1,281 @@
+//nolint
+package consensus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// Local HTTP debug/admin endpoint for a running participant:
+//
+//   GET  /snapshot                    ParticipantSnapshot
+//   GET  /tail                        BlockchainTail, oldest first
+//   GET  /tail?seqno=N or ?hash=HEX   One block with its commit certificate
+//   GET  /candidates                  BlockStatQueue tallies
+//   GET  /peers                       Peers of the connection manager
+//   POST /inject                      Inject a header, as if it had arrived
+//   GET  /metrics                     Metrics, Prometheus text format
+//
+// Requests must name a loopback Host, so that a web page cannot reach
+// the endpoint by DNS rebinding, and POST bodies must be JSON, so that
+// a cross-origin form cannot inject.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+var ErrDebugAddrNotLocal = errors.New("consensus: debug server must bind to a loopback address")
+var ErrDebugHostNotLocal = errors.New("consensus: debug request must be for a loopback host")
+var ErrDebugNotJSON = errors.New("consensus: debug request body must be application/json")
+
+////////////////////////////////////////////////////////////////////////////////
+// Optional extension of ConnectionManagerInterface, for listing peers.
+// Without it, the subscribers of SubscriberSenderInterface are listed.
+type PeerListerInterface interface {
+	GetPeerKeys() []ConnectionKey
+}
+
+////////////////////////////////////////////////////////////////////////////////
+type CertificateSnapshot struct {
+	Seqno uint64   `json:"seqno"`
+	Hash  string   `json:"hash"`
+	Sigs  []string `json:"sigs"`
+}
+
+type InjectRequest struct {
+	Sig   string `json:"sig"`
+	Hash  string `json:"hash"`
+	Seqno uint64 `json:"seqno"`
+}
+
+type InjectResponse struct {
+	Result int `json:"result"` // Return code of on_block_header_arrived()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func NewDebugHandler(p *ConsensusParticipant) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		if !require_method(w, r, http.MethodGet) {
+			return
+		}
+		write_json(w, http.StatusOK, p.Snapshot())
+	})
+
+	mux.HandleFunc("/tail", func(w http.ResponseWriter, r *http.Request) {
+		if !require_method(w, r, http.MethodGet) {
+			return
+		}
+		query := r.URL.Query()
+		if query.Get("seqno") == "" && query.Get("hash") == "" {
+			write_json(w, http.StatusOK, p.Snapshot().Tail)
+			return
+		}
+
+		var cert *CommitCertificate
+		if s := query.Get("seqno"); s != "" {
+			seqno, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				write_error(w, http.StatusBadRequest, err)
+				return
+			}
+			cert = p.GetCommitCertificate(seqno)
+		} else {
+			hash, err := cipher.SHA256FromHex(query.Get("hash"))
+			if err != nil {
+				write_error(w, http.StatusBadRequest, err)
+				return
+			}
+			cert = p.GetCommitCertificateByHash(hash)
+		}
+		if cert == nil {
+			write_error(w, http.StatusNotFound, errors.New("block not in BlockchainTail"))
+			return
+		}
+
+		snap := CertificateSnapshot{Seqno: cert.Seqno, Hash: cert.Hash.Hex()}
+		for _, sig := range cert.Sigs {
+			snap.Sigs = append(snap.Sigs, sig.Hex())
+		}
+		write_json(w, http.StatusOK, snap)
+	})
+
+	mux.HandleFunc("/candidates", func(w http.ResponseWriter, r *http.Request) {
+		if !require_method(w, r, http.MethodGet) {
+			return
+		}
+		write_json(w, http.StatusOK, p.Snapshot().Candidates)
+	})
+
+	mux.HandleFunc("/peers", func(w http.ResponseWriter, r *http.Request) {
+		if !require_method(w, r, http.MethodGet) {
+			return
+		}
+		peers := []ConnectionKey{}
+		switch pMan := p.GetConnectionManager().(type) {
+		case PeerListerInterface:
+			peers = append(peers, pMan.GetPeerKeys()...)
+		case SubscriberSenderInterface:
+			peers = append(peers, pMan.GetSubscriberKeys()...)
+		}
+		write_json(w, http.StatusOK, peers)
+	})
+
+	mux.HandleFunc("/inject", func(w http.ResponseWriter, r *http.Request) {
+		if !require_method(w, r, http.MethodPost) {
+			return
+		}
+		if !require_json(w, r) {
+			return
+		}
+		var req InjectRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			write_error(w, http.StatusBadRequest, err)
+			return
+		}
+		hash, err := cipher.SHA256FromHex(req.Hash)
+		if err != nil {
+			write_error(w, http.StatusBadRequest, err)
+			return
+		}
+		sig, err := cipher.SigFromHex(req.Sig)
+		if err != nil {
+			write_error(w, http.StatusBadRequest, err)
+			return
+		}
+
+		res := p.on_block_header_arrived("", &BlockBase{Sig: sig, Hash: hash, Seqno: req.Seqno})
+		write_json(w, http.StatusOK, InjectResponse{Result: res})
+	})
+
+	mux.Handle("/metrics", NewMetricsHandler(p))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !is_loopback_host(r.Host) {
+			write_error(w, http.StatusForbidden, ErrDebugHostNotLocal)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Whether the Host of a request, with or without a port, is loopback.
+// Host names other than "localhost" are rejected without a lookup, as
+// with DNS rebinding they may resolve to anything.
+func is_loopback_host(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func require_method(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		write_error(w, http.StatusMethodNotAllowed,
+			fmt.Errorf("method %s not allowed", r.Method))
+		return false
+	}
+	return true
+}
+
+func require_json(w http.ResponseWriter, r *http.Request) bool {
+	media_type, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || media_type != "application/json" {
+		write_error(w, http.StatusUnsupportedMediaType, ErrDebugNotJSON)
+		return false
+	}
+	return true
+}
+
+func write_json(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func write_error(w http.ResponseWriter, status int, err error) {
+	write_json(w, status, map[string]string{"error": err.Error()})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// DebugServer serves NewDebugHandler() on a loopback address only, as
+// it exposes the participant's state and lets anybody inject headers.
+//
+////////////////////////////////////////////////////////////////////////////////
+type DebugServer struct {
+	listener net.Listener
+	server   *http.Server
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// 'addr' is host:port, e.g. "127.0.0.1:6060" or "localhost:0". A host
+// name must resolve to loopback addresses only; the server binds to the
+// first of them.
+func StartDebugServer(addr string, p *ConsensusParticipant) (*DebugServer, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		ips, err := net.LookupIP(host)
+		if err != nil {
+			return nil, err
+		}
+		if len(ips) == 0 {
+			return nil, ErrDebugAddrNotLocal
+		}
+		for _, resolved := range ips {
+			if !resolved.IsLoopback() {
+				return nil, ErrDebugAddrNotLocal
+			}
+		}
+		ip = ips[0]
+	}
+	if !ip.IsLoopback() {
+		return nil, ErrDebugAddrNotLocal
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(ip.String(), port))
+	if err != nil {
+		return nil, err
+	}
+
+	self := &DebugServer{
+		listener: listener,
+		server:   &http.Server{Handler: NewDebugHandler(p)},
+	}
+	go self.server.Serve(listener)
+
+	return self, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *DebugServer) Addr() string {
+	return self.listener.Addr().String()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *DebugServer) Close() error {
+	return self.server.Close()
+}
+
+////////////////////////////////////////////////////////////////////////////////
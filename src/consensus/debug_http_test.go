@@ -0,0 +1,216 @@
+//nolint
+package consensus
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/cipher/secp256k1-go"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+func get_json(t *testing.T, url string, v interface{}) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestDebugHandler_01(t *testing.T) {
+	n_signers := 2
+	n_seqno := 9
+
+	hashes, headers := make_signed_headers(n_signers, n_seqno)
+
+	net := new_complete_testNetwork(2, 1)
+	p := net.nodes[0]
+	for seqno := 0; seqno < n_seqno; seqno++ {
+		for i := 0; i < n_signers; i++ {
+			p.OnBlockHeaderArrived(headers[i][seqno])
+		}
+	}
+
+	server := httptest.NewServer(NewDebugHandler(p))
+	defer server.Close()
+
+	var snap ParticipantSnapshot
+	if get_json(t, server.URL+"/snapshot", &snap) != http.StatusOK ||
+		snap.Pubkey != p.Pubkey.Hex() || len(snap.Tail) != 2 {
+		t.Log("/snapshot returned", snap)
+		t.Fail()
+	}
+
+	var tail []BlockSnapshot
+	if get_json(t, server.URL+"/tail", &tail) != http.StatusOK || len(tail) != 2 {
+		t.Log("/tail returned", tail)
+		t.Fail()
+	}
+
+	var cert CertificateSnapshot
+	if get_json(t, server.URL+"/tail?seqno=2", &cert) != http.StatusOK ||
+		cert.Hash != hashes[2].Hex() || len(cert.Sigs) != n_signers+1 {
+		t.Log("/tail?seqno=2 returned", cert)
+		t.Fail()
+	}
+	cert = CertificateSnapshot{}
+	if get_json(t, server.URL+"/tail?hash="+hashes[1].Hex(), &cert) != http.StatusOK ||
+		cert.Seqno != 1 {
+		t.Log("/tail?hash= returned", cert)
+		t.Fail()
+	}
+	if get_json(t, server.URL+"/tail?seqno=5", nil) != http.StatusNotFound {
+		t.Log("/tail?seqno= of an uncommitted block did not return 404.")
+		t.Fail()
+	}
+
+	var candidates []BlockStatSnapshot
+	if get_json(t, server.URL+"/candidates", &candidates) != http.StatusOK ||
+		len(candidates) != n_seqno {
+		t.Log("/candidates returned", candidates)
+		t.Fail()
+	}
+
+	var peers []ConnectionKey
+	if get_json(t, server.URL+"/peers", &peers) != http.StatusOK ||
+		len(peers) != 1 || peers[0] != test_node_key(1) {
+		t.Log("/peers returned", peers)
+		t.Fail()
+	}
+
+	// Inject a header for the next seqno:
+	_, seckey := cipher.GenerateKeyPair()
+	hash := cipher.SumSHA256(secp256k1.RandByte(888))
+	body, _ := json.Marshal(InjectRequest{
+		Sig:   cipher.MustSignHash(hash, seckey).Hex(),
+		Hash:  hash.Hex(),
+		Seqno: uint64(n_seqno + 1),
+	})
+	resp, err := http.Post(server.URL+"/inject", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inject InjectResponse
+	json.NewDecoder(resp.Body).Decode(&inject)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || inject.Result != 0 ||
+		p.Get_block_stat_queue_Len() != n_seqno+1 {
+		t.Log("/inject returned", resp.StatusCode, inject)
+		t.Fail()
+	}
+
+	resp, err = http.Get(server.URL + "/inject")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Log("GET /inject returned", resp.StatusCode)
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestDebugServer_LoopbackOnly(t *testing.T) {
+	p := NewWatchOnlyConsensusParticipantPtr(&discardConnectionManager{})
+
+	if _, err := StartDebugServer("0.0.0.0:0", p); err != ErrDebugAddrNotLocal {
+		t.Log("StartDebugServer() bound to a public address:", err)
+		t.Fail()
+	}
+
+	server, err := StartDebugServer("127.0.0.1:0", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	var snap ParticipantSnapshot
+	if get_json(t, "http://"+server.Addr()+"/snapshot", &snap) != http.StatusOK ||
+		!snap.Watch_only {
+		t.Log("DebugServer /snapshot returned", snap)
+		t.Fail()
+	}
+
+	// "localhost" is resolved, and the server binds to what it resolves to:
+	server, err = StartDebugServer("localhost:0", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	host, _, _ := net.SplitHostPort(server.Addr())
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		t.Log("DebugServer for localhost bound to", server.Addr())
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestDebugHandler_InjectRequiresLocalJSON(t *testing.T) {
+	p := NewWatchOnlyConsensusParticipantPtr(&discardConnectionManager{})
+	handler := NewDebugHandler(p)
+
+	_, seckey := cipher.GenerateKeyPair()
+	hash := cipher.SumSHA256(secp256k1.RandByte(888))
+	body, _ := json.Marshal(InjectRequest{
+		Sig:   cipher.MustSignHash(hash, seckey).Hex(),
+		Hash:  hash.Hex(),
+		Seqno: 1,
+	})
+
+	inject := func(host string, content_type string) int {
+		req := httptest.NewRequest(http.MethodPost, "http://"+host+"/inject", bytes.NewReader(body))
+		req.Header.Set("Content-Type", content_type)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// A cross-origin form can only send text/plain and friends:
+	if code := inject("127.0.0.1:6060", "text/plain"); code != http.StatusUnsupportedMediaType {
+		t.Log("/inject with text/plain returned", code)
+		t.Fail()
+	}
+	if code := inject("127.0.0.1:6060", ""); code != http.StatusUnsupportedMediaType {
+		t.Log("/inject without a Content-Type returned", code)
+		t.Fail()
+	}
+
+	// DNS rebinding reaches us with the attacker's host name:
+	if code := inject("attacker.example:6060", "application/json"); code != http.StatusForbidden {
+		t.Log("/inject for a non-loopback host returned", code)
+		t.Fail()
+	}
+	req := httptest.NewRequest(http.MethodGet, "http://attacker.example/snapshot", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Log("/snapshot for a non-loopback host returned", rec.Code)
+		t.Fail()
+	}
+
+	if p.Get_block_stat_queue_Len() != 0 {
+		t.Fatal("A rejected /inject reached the participant.")
+	}
+
+	for _, host := range []string{"localhost:6060", "[::1]:6060", "127.0.0.1"} {
+		if code := inject(host, "application/json; charset=utf-8"); code != http.StatusOK {
+			t.Log("/inject for", host, "returned", code)
+			t.Fail()
+		}
+	}
+}
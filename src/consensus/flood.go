@@ -0,0 +1,205 @@
+//nolint
+package consensus
+
+import (
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// Per-connection flood protection for OnBlockHeaderArrivedFrom().
+//
+////////////////////////////////////////////////////////////////////////////////
+
+// Token bucket: sustained rate and burst size of messages accepted
+// from one connection.
+var Cfg_flood_rate_per_second float64 = 50
+var Cfg_flood_burst int = 100
+
+// How many messages one connection may send for the same seqno:
+var Cfg_flood_max_messages_per_peer_per_seqno int = 20
+
+// A connection that sends this many messages with invalid signatures
+// is banned for Cfg_flood_ban_duration:
+var Cfg_flood_invalid_sig_ban_threshold int = 3
+var Cfg_flood_ban_duration time.Duration = 10 * time.Minute
+
+// The accounting of a connection that sent nothing for this long, and is
+// not banned, is forgotten; by then its token bucket is full again anyway.
+// Idle connections are looked for at most once per Cfg_flood_peer_sweep_interval.
+var Cfg_flood_peer_idle_expiry time.Duration = 10 * time.Minute
+var Cfg_flood_peer_sweep_interval time.Duration = time.Minute
+
+////////////////////////////////////////////////////////////////////////////////
+// ConnectionKey identifies the connection a message arrived on. It is
+// opaque to this package; the connection manager picks it (e.g. the hex
+// of the remote pubkey, or the remote address).
+type ConnectionKey string
+
+////////////////////////////////////////////////////////////////////////////////
+// Optional extension of ConnectionManagerInterface. If implemented, the
+// participant tells the connection manager about the peers it bans.
+type ConnectionBannerInterface interface {
+	BanConnection(key ConnectionKey, until time.Time)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+type PeerFloodStat struct {
+	tokens      float64
+	last_refill time.Time
+	last_seen   time.Time
+
+	invalid_sig_count int
+	banned_until      time.Time
+
+	seqno2count map[uint64]int
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// FloodGuard does the per-connection accounting. Not safe for
+// concurrent use; ConsensusParticipant calls it under its mutex.
+//
+////////////////////////////////////////////////////////////////////////////////
+type FloodGuard struct {
+	peers      map[ConnectionKey]*PeerFloodStat
+	last_sweep time.Time
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *FloodGuard) Init() {
+	self.peers = make(map[ConnectionKey]*PeerFloodStat)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *FloodGuard) get_peer(key ConnectionKey, now time.Time) *PeerFloodStat {
+	peer, have := self.peers[key]
+	if !have {
+		peer = &PeerFloodStat{
+			tokens:      float64(Cfg_flood_burst),
+			last_refill: now,
+			seqno2count: make(map[uint64]int),
+		}
+		self.peers[key] = peer
+	}
+	peer.last_seen = now
+	return peer
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Forget idle, unbanned connections, so that a peer coming back on ever
+// new connection keys cannot grow the map without bound.
+func (self *FloodGuard) expire_idle_peers(now time.Time) {
+	if now.Sub(self.last_sweep) < Cfg_flood_peer_sweep_interval {
+		return
+	}
+	self.last_sweep = now
+
+	for key, peer := range self.peers {
+		if now.Sub(peer.last_seen) >= Cfg_flood_peer_idle_expiry &&
+			!now.Before(peer.banned_until) {
+			delete(self.peers, key)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Return codes: 0 = admitted, 5 = seqno below 'low', 6 = seqno above 'high',
+// 7 = banned, 8 = rate limited,
+// 9 = too many messages from this connection for this seqno.
+// ['low', 'high'] is the window of seqnos the participant accepts; if
+// 'window' is false there is none yet and seqnos are not counted.
+// Seqnos outside the window still cost a token but are never counted, so
+// a peer cannot push its own counts out with made-up seqnos.
+func (self *FloodGuard) try_admit(
+	key ConnectionKey,
+	seqno uint64,
+	low uint64,
+	high uint64,
+	window bool,
+	now time.Time) int {
+
+	self.expire_idle_peers(now)
+	peer := self.get_peer(key, now)
+
+	if now.Before(peer.banned_until) {
+		return 7
+	}
+
+	// Refill the token bucket:
+	elapsed := now.Sub(peer.last_refill).Seconds()
+	if elapsed > 0 {
+		peer.tokens += elapsed * Cfg_flood_rate_per_second
+		if peer.tokens > float64(Cfg_flood_burst) {
+			peer.tokens = float64(Cfg_flood_burst)
+		}
+		peer.last_refill = now
+	}
+	if peer.tokens < 1 {
+		return 8
+	}
+	peer.tokens -= 1
+
+	if !window {
+		return 0
+	}
+	if seqno < low {
+		return 5
+	}
+	if seqno > high {
+		return 6
+	}
+
+	peer.trim_seqno_counts(low)
+	if peer.seqno2count[seqno] >= Cfg_flood_max_messages_per_peer_per_seqno {
+		return 9
+	}
+	peer.seqno2count[seqno] += 1
+
+	return 0
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Forget the counts of seqnos the window has moved past. Only seqnos
+// inside the window are counted, so the map stays as small as the window.
+func (self *PeerFloodStat) trim_seqno_counts(low uint64) {
+	for seqno, _ := range self.seqno2count {
+		if seqno < low {
+			delete(self.seqno2count, seqno)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Returns true if this invalid signature got the connection banned.
+func (self *FloodGuard) observe_invalid_sig(
+	key ConnectionKey,
+	now time.Time) bool {
+
+	peer := self.get_peer(key, now)
+	peer.invalid_sig_count += 1
+
+	if peer.invalid_sig_count >= Cfg_flood_invalid_sig_ban_threshold {
+		peer.invalid_sig_count = 0
+		peer.banned_until = now.Add(Cfg_flood_ban_duration)
+		return true
+	}
+	return false
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *FloodGuard) IsBanned(key ConnectionKey, now time.Time) bool {
+	peer, have := self.peers[key]
+	return have && now.Before(peer.banned_until)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *FloodGuard) get_banned_until(key ConnectionKey) time.Time {
+	peer, have := self.peers[key]
+	if !have {
+		return time.Time{}
+	}
+	return peer.banned_until
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,251 @@
+//nolint
+package consensus
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/cipher/secp256k1-go"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+type fakeClock struct {
+	now time.Time
+}
+
+func (self *fakeClock) Now() time.Time { return self.now }
+
+func (self *fakeClock) Advance(d time.Duration) { self.now = self.now.Add(d) }
+
+////////////////////////////////////////////////////////////////////////////////
+type bannerConnectionManager struct {
+	discardConnectionManager
+	banned map[ConnectionKey]time.Time
+}
+
+func (self *bannerConnectionManager) BanConnection(
+	key ConnectionKey,
+	until time.Time) {
+
+	self.banned[key] = until
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestBlockStat_MaxCandidateMessages(t *testing.T) {
+	bs := BlockStat{}
+	bs.Init()
+
+	hash := cipher.SumSHA256(secp256k1.RandByte(888))
+
+	for i := 0; i < Cfg_consensus_max_candidate_messages; i++ {
+		_, seckey := cipher.GenerateKeyPair()
+		if bs.try_add_hash_and_sig(hash, cipher.MustSignHash(hash, seckey)) != 0 {
+			t.Log("BlockStat::try_add_hash_and_sig() failed to add.")
+			t.Fail()
+		}
+	}
+
+	_, seckey := cipher.GenerateKeyPair()
+	if bs.try_add_hash_and_sig(hash, cipher.MustSignHash(hash, seckey)) != 2 {
+		t.Log("BlockStat::try_add_hash_and_sig() failed to enforce Cfg_consensus_max_candidate_messages.")
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestFloodGuard_TokenBucket(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	fg := FloodGuard{}
+	fg.Init()
+
+	key := ConnectionKey("peer-1")
+
+	// Spread over many seqnos so that only the bucket limits:
+	for i := 0; i < Cfg_flood_burst; i++ {
+		if fg.try_admit(key, uint64(i), 0, 0, false, clock.Now()) != 0 {
+			t.Log("FloodGuard::try_admit() rejected a message within the burst.")
+			t.Fail()
+		}
+	}
+	if fg.try_admit(key, 0, 0, 0, false, clock.Now()) != 8 {
+		t.Log("FloodGuard::try_admit() failed to rate limit.")
+		t.Fail()
+	}
+	if fg.try_admit(ConnectionKey("peer-2"), 0, 0, 0, false, clock.Now()) != 0 {
+		t.Log("FloodGuard::try_admit() rate limited an unrelated connection.")
+		t.Fail()
+	}
+
+	clock.Advance(time.Second)
+	n := 0
+	for fg.try_admit(key, 1000+uint64(n), 0, 0, false, clock.Now()) == 0 {
+		n++
+	}
+	if n != int(Cfg_flood_rate_per_second) {
+		t.Log("FloodGuard::try_admit() refilled", n, "tokens in one second.")
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestFloodGuard_ExpireIdlePeers(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	fg := FloodGuard{}
+	fg.Init()
+
+	for i := 0; i < 1000; i++ {
+		fg.try_admit(ConnectionKey(fmt.Sprintf("peer-%d", i)), 1, 0, 0, false, clock.Now())
+	}
+
+	clock.Advance(Cfg_flood_peer_idle_expiry - time.Second)
+	fg.try_admit(ConnectionKey("active"), 1, 0, 0, false, clock.Now())
+	if len(fg.peers) != 1001 {
+		t.Log("FloodGuard::try_admit() forgot", 1001-len(fg.peers), "peers before they expired.")
+		t.Fail()
+	}
+
+	// Banned peers are kept however idle, until the ban ends:
+	saved := Cfg_flood_ban_duration
+	defer func() { Cfg_flood_ban_duration = saved }()
+	Cfg_flood_ban_duration = 2 * Cfg_flood_peer_idle_expiry
+	banned := ConnectionKey("banned")
+	for i := 0; i < Cfg_flood_invalid_sig_ban_threshold; i++ {
+		fg.observe_invalid_sig(banned, clock.Now())
+	}
+	clock.Advance(Cfg_flood_peer_idle_expiry)
+	fg.try_admit(ConnectionKey("active"), 2, 0, 0, false, clock.Now())
+	if len(fg.peers) != 2 || !fg.IsBanned(banned, clock.Now()) {
+		t.Log("FloodGuard::try_admit() kept", len(fg.peers), "peers, banned:", fg.IsBanned(banned, clock.Now()))
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestFloodGuard_PerSeqnoCap(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	fg := FloodGuard{}
+	fg.Init()
+
+	key := ConnectionKey("peer-1")
+
+	for i := 0; i < Cfg_flood_max_messages_per_peer_per_seqno; i++ {
+		fg.try_admit(key, 5, 1, 20, true, clock.Now())
+	}
+	if fg.try_admit(key, 5, 1, 20, true, clock.Now()) != 9 {
+		t.Log("FloodGuard::try_admit() failed to enforce the per-seqno cap.")
+		t.Fail()
+	}
+	if fg.try_admit(key, 6, 1, 20, true, clock.Now()) != 0 {
+		t.Log("FloodGuard::try_admit() applied the per-seqno cap to another seqno.")
+		t.Fail()
+	}
+
+	// Seqnos outside the window are refused and not counted:
+	if fg.try_admit(key, 0, 1, 20, true, clock.Now()) != 5 ||
+		fg.try_admit(key, 21, 1, 20, true, clock.Now()) != 6 {
+		t.Log("FloodGuard::try_admit() admitted a seqno outside the window.")
+		t.Fail()
+	}
+	if len(fg.peers[key].seqno2count) != 2 {
+		t.Log("FloodGuard::try_admit() counted", len(fg.peers[key].seqno2count), "seqnos")
+		t.Fail()
+	}
+
+	// Counts are forgotten once the window moves past them:
+	fg.try_admit(key, 7, 6, 25, true, clock.Now())
+	if _, have := fg.peers[key].seqno2count[5]; have {
+		t.Log("PeerFloodStat::trim_seqno_counts() did not trim.")
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// A peer must not get past the per-seqno cap by sending far-ahead seqnos
+// to push its own count for the current seqno out of the accounting.
+func TestConsensusParticipant_PerSeqnoCapBypass(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	p := NewConsensusParticipantPtr(&discardConnectionManager{}, nil)
+	p.SetClock(clock.Now)
+
+	hash := cipher.SumSHA256(secp256k1.RandByte(888))
+	send := func(key ConnectionKey, seqno uint64) int {
+		_, seckey := cipher.GenerateKeyPair()
+		return p.on_block_header_arrived(key, &BlockBase{
+			Sig:   cipher.MustSignHash(hash, seckey),
+			Hash:  hash,
+			Seqno: seqno,
+		})
+	}
+	send(ConnectionKey("honest"), 1)
+
+	bad := ConnectionKey("bad-peer")
+	admitted := 0
+	for round := 0; round < 2; round++ {
+		for i := 0; i < Cfg_flood_max_messages_per_peer_per_seqno; i++ {
+			if send(bad, 1) != 9 {
+				admitted++
+			}
+		}
+		for i := 0; i < Cfg_flood_max_messages_per_peer_per_seqno; i++ {
+			if r := send(bad, uint64(1000000+i)); r != 6 {
+				t.Log("ConsensusParticipant::on_block_header_arrived() returned", r,
+					"for a far-ahead seqno")
+				t.Fail()
+			}
+		}
+	}
+	if admitted != Cfg_flood_max_messages_per_peer_per_seqno {
+		t.Log("FloodGuard::try_admit() admitted", admitted, "messages for one seqno")
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_BanInvalidSig(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	pMan := &bannerConnectionManager{banned: make(map[ConnectionKey]time.Time)}
+	p := NewConsensusParticipantPtr(pMan, NewRandomMemorySigner())
+	p.SetClock(clock.Now)
+
+	bad := ConnectionKey("bad-peer")
+	hash := cipher.SumSHA256(secp256k1.RandByte(888))
+
+	for i := 0; i < Cfg_flood_invalid_sig_ban_threshold; i++ {
+		b := BlockBase{Hash: hash, Seqno: 1} // Empty '.sig' is invalid
+		if r := p.on_block_header_arrived(bad, &b); r != 4 {
+			t.Log("ConsensusParticipant::on_block_header_arrived() returned", r)
+			t.Fail()
+		}
+	}
+	if !p.IsBanned(bad) {
+		t.Log("ConsensusParticipant::IsBanned() peer sending invalid signatures not banned.")
+		t.Fail()
+	}
+	if _, have := pMan.banned[bad]; !have {
+		t.Log("ConnectionBannerInterface::BanConnection() not called.")
+		t.Fail()
+	}
+
+	_, seckey := cipher.GenerateKeyPair()
+	good := BlockBase{Sig: cipher.MustSignHash(hash, seckey), Hash: hash, Seqno: 1}
+	if r := p.on_block_header_arrived(bad, &good); r != 7 {
+		t.Log("ConsensusParticipant::on_block_header_arrived() accepted a banned peer:", r)
+		t.Fail()
+	}
+	if pMan.sent != 0 {
+		t.Log("ConsensusParticipant::on_block_header_arrived() forwarded from a banned peer.")
+		t.Fail()
+	}
+
+	clock.Advance(Cfg_flood_ban_duration)
+	if p.IsBanned(bad) {
+		t.Log("ConsensusParticipant::IsBanned() ban did not expire.")
+		t.Fail()
+	}
+	if r := p.on_block_header_arrived(bad, &good); r != 0 {
+		t.Log("ConsensusParticipant::on_block_header_arrived() rejected after ban expired:", r)
+		t.Fail()
+	}
+}
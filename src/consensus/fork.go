@@ -0,0 +1,283 @@
+//nolint
+package consensus
+
+import (
+	"errors"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// Fork handling. A participant that committed a minority hash (e.g.
+// during a network partition) replaces it when a peer presents commit
+// certificates with more support, within a bounded depth.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+// How many of the most recent blocks in BlockchainTail may be replaced
+// by a reorganization:
+var Cfg_blockchain_max_reorg_depth uint64 = 10
+
+var ErrCertificateNoSigs = errors.New("consensus: commit certificate has no signatures")
+var ErrCertificateBadSig = errors.New("consensus: commit certificate has an invalid signature")
+var ErrCertificateDupSigner = errors.New("consensus: commit certificate has a duplicate signer")
+
+////////////////////////////////////////////////////////////////////////////////
+// CommitCertificate is a committed block together with the signatures
+// of the distinct signers that supported it.
+type CommitCertificate struct {
+	Seqno uint64
+	Hash  cipher.SHA256
+	Sigs  []cipher.Sig
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Returns the support, i.e. the number of distinct signers.
+func (self *CommitCertificate) Verify() (int, error) {
+	if len(self.Sigs) == 0 {
+		return 0, ErrCertificateNoSigs
+	}
+	if self.Hash == (cipher.SHA256{}) {
+		return 0, ErrCertificateBadSig
+	}
+
+	signers := make(map[cipher.PubKey]byte)
+	for _, sig := range self.Sigs {
+		// PERFORMANCE: This is expensive:
+		pubkey, err := cipher.PubKeyFromSig(sig, self.Hash)
+		if err != nil {
+			return 0, ErrCertificateBadSig
+		}
+		if _, have := signers[pubkey]; have {
+			return 0, ErrCertificateDupSigner
+		}
+		signers[pubkey] = byte('1')
+	}
+	return len(signers), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// ReorgEvent describes a replacement of the most recent part of
+// BlockchainTail. Old_blocks and New_blocks are oldest first.
+type ReorgEvent struct {
+	Fork_seqno uint64
+	Old_blocks []*BlockBase
+	New_blocks []*BlockBase
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// The handler is called after every reorganization, without the
+// participant's mutex held.
+func (self *ConsensusParticipant) SetReorgHandler(handler func(ReorgEvent)) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.reorg_handler = handler
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Returns nil if the block at 'seqno' is not in BlockchainTail.
+func (self *ConsensusParticipant) GetCommitCertificate(seqno uint64) *CommitCertificate {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return self.get_commit_certificate(seqno)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Returns nil if no block with 'hash' is in BlockchainTail.
+func (self *ConsensusParticipant) GetCommitCertificateByHash(
+	hash cipher.SHA256) *CommitCertificate {
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	blockPtr, have := self.block_queue.hash_to_blockPtr_map[hash]
+	if !have {
+		return nil
+	}
+	return self.get_commit_certificate(blockPtr.Seqno)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Caller must hold self.mutex.
+func (self *ConsensusParticipant) get_commit_certificate(seqno uint64) *CommitCertificate {
+	blockPtr := self.block_queue.get_block_at(seqno)
+	if blockPtr == nil {
+		return nil
+	}
+
+	sigs := self.block_queue.get_sigs(blockPtr.Hash)
+	if len(sigs) == 0 {
+		sigs = []cipher.Sig{blockPtr.Sig}
+	}
+	return &CommitCertificate{
+		Seqno: blockPtr.Seqno,
+		Hash:  blockPtr.Hash,
+		Sigs:  append([]cipher.Sig(nil), sigs...),
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Returns the certificates of our committed blocks from 'seqno' onward,
+// for sending to a peer that may have diverged.
+func (self *ConsensusParticipant) GetCommitBranch(seqno uint64) []*CommitCertificate {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	var branch []*CommitCertificate
+	for {
+		cert := self.get_commit_certificate(seqno)
+		if cert == nil {
+			break
+		}
+		branch = append(branch, cert)
+		seqno++
+	}
+	return branch
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Considers a peer's branch, i.e. certificates for contiguous seqnos.
+// POLICY: At the first seqno where the branch differs from our
+// BlockchainTail, if its certificate has strictly more support than our
+// commit, we roll back to that seqno and replay the branch. The blocks
+// we rolled back beyond the end of the branch are decided again from
+// their BlockStat.
+//
+// Return codes: 0 = reorganized, 1 = no divergence, 2 = not more
+// support, 3 = fork deeper than Cfg_blockchain_max_reorg_depth or
+// older than BlockchainTail, 4 = invalid certificate, 5 = branch not
+// contiguous, 6 = branch repeats a hash, so it cannot be replayed.
+func (self *ConsensusParticipant) OnCommitBranchArrived(
+	branch []*CommitCertificate) int {
+
+	if len(branch) == 0 {
+		return 1
+	}
+
+	// Verify outside the mutex, as it is expensive:
+	support := make([]int, len(branch))
+	for i, cert := range branch {
+		if i > 0 && cert.Seqno != branch[i-1].Seqno+1 {
+			return 5
+		}
+		n, err := cert.Verify()
+		if err != nil {
+			return 4
+		}
+		support[i] = n
+	}
+
+	self.mutex.Lock()
+
+	event, res := self.try_reorganize(branch, support)
+	handler := self.reorg_handler
+
+	self.mutex.Unlock()
+
+	if res == 0 && handler != nil {
+		handler(event)
+	}
+	return res
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Caller must hold self.mutex.
+func (self *ConsensusParticipant) try_reorganize(
+	branch []*CommitCertificate,
+	support []int) (ReorgEvent, int) {
+
+	// Find the first divergence:
+	i := 0
+	var ourPtr *BlockBase
+	for ; i < len(branch); i++ {
+		ourPtr = self.block_queue.get_block_at(branch[i].Seqno)
+		if ourPtr == nil || ourPtr.Hash != branch[i].Hash {
+			break
+		}
+	}
+	if i == len(branch) {
+		return ReorgEvent{}, 1
+	}
+
+	fork := branch[i]
+	next := self.block_queue.GetNextSeqNo()
+
+	if ourPtr == nil {
+		if fork.Seqno >= next {
+			return ReorgEvent{}, 1 // Peer is ahead of us, not diverged
+		}
+		return ReorgEvent{}, 3 // Older than what we hold
+	}
+	if next-fork.Seqno > Cfg_blockchain_max_reorg_depth {
+		return ReorgEvent{}, 3
+	}
+
+	// The real number of signers, not only those whose signatures we
+	// kept:
+	our_support := self.block_queue.get_support(ourPtr.Hash)
+	if support[i] <= our_support {
+		return ReorgEvent{}, 2
+	}
+
+	// Replaying must not fail once we rolled back, so check first that
+	// every hash is new to what we keep:
+	seen := make(map[cipher.SHA256]byte)
+	for _, cert := range branch[i:] {
+		if _, have := seen[cert.Hash]; have {
+			return ReorgEvent{}, 6
+		}
+		seen[cert.Hash] = byte('1')
+		if blockPtr, have := self.block_queue.hash_to_blockPtr_map[cert.Hash]; have &&
+			blockPtr.Seqno < fork.Seqno {
+			return ReorgEvent{}, 6
+		}
+	}
+
+	// Roll back, then replay the better branch:
+	event := ReorgEvent{Fork_seqno: fork.Seqno}
+	event.Old_blocks = self.block_queue.rollback_from(fork.Seqno)
+
+	for j, cert := range branch[i:] {
+		blockPtr := &BlockBase{Sig: cert.Sigs[0], Hash: cert.Hash, Seqno: cert.Seqno}
+		self.block_queue.append_nocheck(blockPtr)
+		self.block_queue.set_sigs(cert.Hash, append([]cipher.Sig(nil), cert.Sigs...))
+		self.block_queue.set_support(cert.Hash, support[i+j])
+		event.New_blocks = append(event.New_blocks, blockPtr)
+	}
+
+	// Blocks past the end of the branch get decided again. Those the
+	// branch decided for us, including any past our old tail, take no
+	// more votes:
+	replayed_to := self.block_queue.GetNextSeqNo()
+	for _, statPtr := range self.block_stat_queue.queue {
+		if statPtr.seqno >= replayed_to {
+			statPtr.frozen = false
+		} else if !statPtr.frozen {
+			self.freeze_BlockStat(statPtr)
+		}
+	}
+	self.harvest_ripe_BlockStat()
+
+	for _, blockPtr := range self.block_queue.blockPtr_slice {
+		if blockPtr.Seqno >= replayed_to {
+			event.New_blocks = append(event.New_blocks, blockPtr)
+		}
+	}
+
+	self.metrics.Reorgs += 1
+
+	return event, 0
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *ConsensusParticipant) Get_reorg_count() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return int(self.metrics.Reorgs)
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,304 @@
+//nolint
+package consensus
+
+import (
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/cipher/secp256k1-go"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// Feeds 'p' with headers for seqnos 1..len(hashes)-1, each signed by
+// 'n_signers[seqno]' fresh signers.
+func feed_headers(p *ConsensusParticipant, hashes []cipher.SHA256, n_signers []int) {
+	for seqno := 1; seqno < len(hashes); seqno++ {
+		for i := 0; i < n_signers[seqno]; i++ {
+			_, seckey := cipher.GenerateKeyPair()
+			p.OnBlockHeaderArrived(&BlockBase{
+				Sig:   cipher.MustSignHash(hashes[seqno], seckey),
+				Hash:  hashes[seqno],
+				Seqno: uint64(seqno),
+			})
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Two partitions agree on all seqnos except 'fork_seqno', where the
+// minority committed another hash with less support.
+func make_partitioned_pair(t *testing.T, n_seqno int, fork_seqno int) (
+	minority *ConsensusParticipant,
+	majority *ConsensusParticipant) {
+
+	hashes := make([]cipher.SHA256, n_seqno+1)
+	n_signers := make([]int, n_seqno+1)
+	for seqno := 1; seqno <= n_seqno; seqno++ {
+		hashes[seqno] = cipher.SumSHA256(secp256k1.RandByte(888))
+		n_signers[seqno] = 3
+	}
+
+	majority = NewConsensusParticipantPtr(&discardConnectionManager{}, NewRandomMemorySigner())
+	feed_headers(majority, hashes, n_signers)
+
+	hashes_minority := append([]cipher.SHA256(nil), hashes...)
+	hashes_minority[fork_seqno] = cipher.SumSHA256(secp256k1.RandByte(888))
+	n_signers[fork_seqno] = 1
+
+	minority = NewConsensusParticipantPtr(&discardConnectionManager{}, NewRandomMemorySigner())
+	feed_headers(minority, hashes_minority, n_signers)
+
+	if minority.GetNextBlockSeqNo() != majority.GetNextBlockSeqNo() {
+		t.Fatal("Partitions committed different lengths.")
+	}
+	return minority, majority
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func same_tail(a *ConsensusParticipant, b *ConsensusParticipant) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(a.block_queue.blockPtr_slice) != len(b.block_queue.blockPtr_slice) {
+		return false
+	}
+	for i, blockPtr := range a.block_queue.blockPtr_slice {
+		other := b.block_queue.blockPtr_slice[i]
+		if blockPtr.Seqno != other.Seqno || blockPtr.Hash != other.Hash {
+			return false
+		}
+	}
+	return true
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestCommitCertificate_Verify(t *testing.T) {
+	hash := cipher.SumSHA256(secp256k1.RandByte(888))
+	_, seckey1 := cipher.GenerateKeyPair()
+	_, seckey2 := cipher.GenerateKeyPair()
+
+	cert := CommitCertificate{Seqno: 1, Hash: hash, Sigs: []cipher.Sig{
+		cipher.MustSignHash(hash, seckey1),
+		cipher.MustSignHash(hash, seckey2),
+	}}
+	if n, err := cert.Verify(); err != nil || n != 2 {
+		t.Log("CommitCertificate::Verify() failed:", n, err)
+		t.Fail()
+	}
+
+	cert.Sigs = append(cert.Sigs, cipher.MustSignHash(hash, seckey1))
+	if _, err := cert.Verify(); err != ErrCertificateDupSigner {
+		t.Log("CommitCertificate::Verify() counted a signer twice.")
+		t.Fail()
+	}
+
+	cert.Sigs = []cipher.Sig{{}}
+	if _, err := cert.Verify(); err != ErrCertificateBadSig {
+		t.Log("CommitCertificate::Verify() accepted an invalid signature.")
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_Reorg(t *testing.T) {
+	minority, majority := make_partitioned_pair(t, 12, 3)
+
+	if same_tail(minority, majority) {
+		t.Fatal("Partitions did not diverge.")
+	}
+
+	var events []ReorgEvent
+	minority.SetReorgHandler(func(e ReorgEvent) { events = append(events, e) })
+
+	// The majority does not switch to the branch with less support:
+	if r := majority.OnCommitBranchArrived(minority.GetCommitBranch(1)); r != 2 {
+		t.Log("OnCommitBranchArrived() with less support returned", r)
+		t.Fail()
+	}
+
+	if r := minority.OnCommitBranchArrived(majority.GetCommitBranch(1)); r != 0 {
+		t.Fatal("OnCommitBranchArrived() with more support returned", r)
+	}
+	if !same_tail(minority, majority) {
+		t.Log("OnCommitBranchArrived() did not adopt the better branch.")
+		t.Fail()
+	}
+	if len(events) != 1 || events[0].Fork_seqno != 3 ||
+		len(events[0].Old_blocks) != 3 || len(events[0].New_blocks) != 3 {
+		t.Log("ReorgEvent not emitted as expected:", events)
+		t.Fail()
+	}
+	if minority.Get_reorg_count() != 1 {
+		t.Log("Get_reorg_count() is", minority.Get_reorg_count())
+		t.Fail()
+	}
+
+	// Nothing left to do:
+	if r := minority.OnCommitBranchArrived(majority.GetCommitBranch(1)); r != 1 {
+		t.Log("OnCommitBranchArrived() on the same branch returned", r)
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_ReorgShortBranch(t *testing.T) {
+	minority, majority := make_partitioned_pair(t, 12, 3)
+
+	// Only the certificate for the diverged seqno; the rolled back
+	// blocks after it are decided again from BlockStat:
+	branch := majority.GetCommitBranch(3)[:1]
+	if r := minority.OnCommitBranchArrived(branch); r != 0 {
+		t.Fatal("OnCommitBranchArrived() returned", r)
+	}
+	if !same_tail(minority, majority) {
+		t.Log("OnCommitBranchArrived() did not rebuild the tail after the branch.")
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_ReorgTooDeep(t *testing.T) {
+	saved := Cfg_blockchain_max_reorg_depth
+	defer func() { Cfg_blockchain_max_reorg_depth = saved }()
+	Cfg_blockchain_max_reorg_depth = 2
+
+	minority, majority := make_partitioned_pair(t, 12, 3)
+
+	if r := minority.OnCommitBranchArrived(majority.GetCommitBranch(1)); r != 3 {
+		t.Log("OnCommitBranchArrived() beyond the max depth returned", r)
+		t.Fail()
+	}
+
+	branch := majority.GetCommitBranch(1)
+	branch[1], branch[2] = branch[2], branch[1]
+	if r := minority.OnCommitBranchArrived(branch); r != 5 {
+		t.Log("OnCommitBranchArrived() with a non-contiguous branch returned", r)
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func make_certificate(seqno uint64, hash cipher.SHA256, n_signers int) *CommitCertificate {
+	cert := &CommitCertificate{Seqno: seqno, Hash: hash}
+	for i := 0; i < n_signers; i++ {
+		_, seckey := cipher.GenerateKeyPair()
+		cert.Sigs = append(cert.Sigs, cipher.MustSignHash(hash, seckey))
+	}
+	return cert
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_ReorgRealSupport(t *testing.T) {
+	saved := Cfg_consensus_max_candidate_messages
+	defer func() { Cfg_consensus_max_candidate_messages = saved }()
+	Cfg_consensus_max_candidate_messages = 2
+
+	hashes := make([]cipher.SHA256, 13)
+	n_signers := make([]int, 13)
+	for seqno := 1; seqno <= 12; seqno++ {
+		hashes[seqno] = cipher.SumSHA256(secp256k1.RandByte(888))
+		n_signers[seqno] = 5
+	}
+	p := NewConsensusParticipantPtr(&discardConnectionManager{}, nil)
+	feed_headers(p, hashes, n_signers)
+
+	// Only 2 signatures are kept, but 5 signers support our commit:
+	if n := len(p.GetCommitCertificate(3).Sigs); n != 2 {
+		t.Fatal("Expected 2 signatures kept, got", n)
+	}
+
+	other := cipher.SumSHA256(secp256k1.RandByte(888))
+	branch := []*CommitCertificate{make_certificate(3, other, 3)}
+	if r := p.OnCommitBranchArrived(branch); r != 2 {
+		t.Log("OnCommitBranchArrived() with less than the real support returned", r)
+		t.Fail()
+	}
+
+	branch = []*CommitCertificate{make_certificate(3, other, 6)}
+	if r := p.OnCommitBranchArrived(branch); r != 0 {
+		t.Log("OnCommitBranchArrived() with more than the real support returned", r)
+		t.Fail()
+	}
+	if cert := p.GetCommitCertificate(3); cert == nil || cert.Hash != other {
+		t.Log("OnCommitBranchArrived() did not adopt the better certificate.")
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_ReorgRepeatedHash(t *testing.T) {
+	minority, majority := make_partitioned_pair(t, 12, 3)
+
+	before := minority.GetCommitBranch(1)
+
+	// The better certificate for seqno 3 repeats the hash committed at
+	// seqno 1, so the branch cannot be replayed:
+	branch := majority.GetCommitBranch(3)
+	branch[0] = make_certificate(3, before[0].Hash, 10)
+	if r := minority.OnCommitBranchArrived(branch); r != 6 {
+		t.Log("OnCommitBranchArrived() with a repeated hash returned", r)
+		t.Fail()
+	}
+
+	// Repeats within the branch:
+	branch = majority.GetCommitBranch(3)
+	branch[1] = make_certificate(4, branch[0].Hash, 10)
+	if r := minority.OnCommitBranchArrived(branch); r != 6 {
+		t.Log("OnCommitBranchArrived() with a hash repeated in the branch returned", r)
+		t.Fail()
+	}
+
+	after := minority.GetCommitBranch(1)
+	if len(after) != len(before) {
+		t.Fatal("BlockchainTail changed length from", len(before), "to", len(after))
+	}
+	for i := range before {
+		if after[i].Hash != before[i].Hash {
+			t.Log("BlockchainTail changed at seqno", before[i].Seqno)
+			t.Fail()
+		}
+	}
+	if minority.Get_reorg_count() != 0 {
+		t.Log("Get_reorg_count() is", minority.Get_reorg_count())
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_ReorgPastTail(t *testing.T) {
+	minority, majority := make_partitioned_pair(t, 12, 3)
+
+	// The majority decides 3 more seqnos, which the minority has in
+	// BlockStat but not yet in BlockchainTail:
+	hashes := make([]cipher.SHA256, 16)
+	n_signers := make([]int, 16)
+	for seqno := 13; seqno <= 15; seqno++ {
+		hashes[seqno] = cipher.SumSHA256(secp256k1.RandByte(888))
+		n_signers[seqno] = 3
+	}
+	feed_headers(majority, hashes, n_signers)
+
+	next := minority.GetNextBlockSeqNo()
+	if r := minority.OnCommitBranchArrived(majority.GetCommitBranch(1)); r != 0 {
+		t.Fatal("OnCommitBranchArrived() returned", r)
+	}
+	if minority.GetNextBlockSeqNo() <= next {
+		t.Fatal("The branch did not run past the old tail.")
+	}
+
+	minority.mutex.Lock()
+	replayed_to := minority.block_queue.GetNextSeqNo()
+	for _, statPtr := range minority.block_stat_queue.queue {
+		if statPtr.seqno < replayed_to && !statPtr.frozen {
+			t.Log("BlockStat at seqno", statPtr.seqno, "is not frozen after the reorg.")
+			t.Fail()
+		}
+		if _, have := minority.seqno2vote[statPtr.seqno]; have && statPtr.seqno < replayed_to {
+			t.Log("Vote at seqno", statPtr.seqno, "is still remembered after the reorg.")
+			t.Fail()
+		}
+	}
+	minority.mutex.Unlock()
+}
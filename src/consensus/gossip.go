@@ -0,0 +1,94 @@
+//nolint
+package consensus
+
+import (
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// Forwarding deduplication and fan-out control.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+// How many recently accepted (hash,sig) pairs to remember, so that
+// repeated copies are dropped before the (expensive) pubkey recovery
+// and are not forwarded again:
+var Cfg_gossip_seen_cache_size int = 4096
+
+// How many subscribers to push each accepted header to. Zero means all
+// of them. Only honored if the connection manager implements
+// SubscriberSenderInterface.
+var Cfg_gossip_fanout int = 0
+
+////////////////////////////////////////////////////////////////////////////////
+// Optional extension of ConnectionManagerInterface, for sending to
+// individual subscribers rather than to all of them.
+type SubscriberSenderInterface interface {
+	GetSubscriberKeys() []ConnectionKey
+	SendBlockToSubscriber(key ConnectionKey, blockPtr *BlockBase)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+type GossipStat struct {
+	Duplicate_suppressed_count int // Dropped by the seen-message cache
+	Forwarded_count            int // Headers forwarded
+	Pushed_count               int // Individual pushes, if known
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// SeenCache remembers the most recent (hash,sig) pairs, evicting the
+// oldest one first.
+//
+////////////////////////////////////////////////////////////////////////////////
+type SeenKey struct {
+	Hash cipher.SHA256
+	Sig  cipher.Sig
+}
+
+type SeenCache struct {
+	key2none map[SeenKey]byte
+	ring     []SeenKey // Insertion order, for eviction
+	next     int       // Where the next key goes in 'ring'
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *SeenCache) Init() {
+	self.key2none = make(map[SeenKey]byte)
+	self.ring = nil
+	self.next = 0
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *SeenCache) Has(hash cipher.SHA256, sig cipher.Sig) bool {
+	_, have := self.key2none[SeenKey{Hash: hash, Sig: sig}]
+	return have
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *SeenCache) Add(hash cipher.SHA256, sig cipher.Sig) {
+	if Cfg_gossip_seen_cache_size <= 0 {
+		return
+	}
+	key := SeenKey{Hash: hash, Sig: sig}
+	if _, have := self.key2none[key]; have {
+		return
+	}
+
+	if len(self.ring) < Cfg_gossip_seen_cache_size {
+		self.ring = append(self.ring, key)
+	} else {
+		delete(self.key2none, self.ring[self.next])
+		self.ring[self.next] = key
+		self.next = (self.next + 1) % len(self.ring)
+	}
+	self.key2none[key] = byte('1')
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *SeenCache) Len() int {
+	return len(self.key2none)
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,208 @@
+//nolint
+package consensus
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/cipher/secp256k1-go"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// In-process multi-node harness: messages are queued and delivered one
+// at a time, in FIFO order.
+//
+////////////////////////////////////////////////////////////////////////////////
+type testDelivery struct {
+	to       int
+	from     ConnectionKey
+	blockPtr *BlockBase
+}
+
+type testNetwork struct {
+	nodes    []*ConsensusParticipant
+	managers []*testConnectionManager
+	pending  []testDelivery
+	sent     int
+}
+
+type testConnectionManager struct {
+	net         *testNetwork
+	index       int
+	subscribers []int
+}
+
+func test_node_key(i int) ConnectionKey {
+	return ConnectionKey(fmt.Sprintf("node-%d", i))
+}
+
+func (self *testConnectionManager) Print() {}
+
+func (self *testConnectionManager) SendBlockToAllMySubscriber(
+	blockPtr *BlockBase) {
+
+	for _, to := range self.subscribers {
+		self.net.enqueue(self.index, to, blockPtr)
+	}
+}
+
+func (self *testConnectionManager) GetSubscriberKeys() []ConnectionKey {
+	var keys []ConnectionKey
+	for _, to := range self.subscribers {
+		keys = append(keys, test_node_key(to))
+	}
+	return keys
+}
+
+func (self *testConnectionManager) SendBlockToSubscriber(
+	key ConnectionKey,
+	blockPtr *BlockBase) {
+
+	for _, to := range self.subscribers {
+		if test_node_key(to) == key {
+			self.net.enqueue(self.index, to, blockPtr)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Every node subscribes to every other node.
+func new_complete_testNetwork(n int, seed int64) *testNetwork {
+	net := &testNetwork{}
+	for i := 0; i < n; i++ {
+		pMan := &testConnectionManager{net: net, index: i}
+		for j := 0; j < n; j++ {
+			if j != i {
+				pMan.subscribers = append(pMan.subscribers, j)
+			}
+		}
+		p := NewConsensusParticipantPtr(pMan, NewRandomMemorySigner())
+		p.SetRand(rand.New(rand.NewSource(seed + int64(i))))
+		net.managers = append(net.managers, pMan)
+		net.nodes = append(net.nodes, p)
+	}
+	return net
+}
+
+func (self *testNetwork) enqueue(from int, to int, blockPtr *BlockBase) {
+	self.sent += 1
+	self.pending = append(self.pending,
+		testDelivery{to: to, from: test_node_key(from), blockPtr: blockPtr})
+}
+
+func (self *testNetwork) run() {
+	for len(self.pending) > 0 {
+		d := self.pending[0]
+		self.pending = self.pending[1:]
+		self.nodes[d.to].OnBlockHeaderArrivedFrom(d.from, d.blockPtr)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestSeenCache_Eviction(t *testing.T) {
+	saved := Cfg_gossip_seen_cache_size
+	defer func() { Cfg_gossip_seen_cache_size = saved }()
+	Cfg_gossip_seen_cache_size = 3
+
+	sc := SeenCache{}
+	sc.Init()
+
+	var hashes []cipher.SHA256
+	for i := 0; i < 4; i++ {
+		h := cipher.SumSHA256(secp256k1.RandByte(888))
+		hashes = append(hashes, h)
+		sc.Add(h, cipher.Sig{})
+		sc.Add(h, cipher.Sig{}) // No-op
+	}
+
+	if sc.Len() != 3 || sc.Has(hashes[0], cipher.Sig{}) ||
+		!sc.Has(hashes[3], cipher.Sig{}) {
+		t.Log("SeenCache::Add() did not evict the oldest entry.")
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func run_gossip(t *testing.T, n_nodes int, fanout int) *testNetwork {
+	saved, saved_votes := Cfg_gossip_fanout, Cfg_consensus_cast_votes
+	defer func() {
+		Cfg_gossip_fanout, Cfg_consensus_cast_votes = saved, saved_votes
+	}()
+	Cfg_gossip_fanout = fanout
+	Cfg_consensus_cast_votes = false // Count relayed headers only
+
+	net := new_complete_testNetwork(n_nodes, 1)
+
+	n_headers := 5
+	for i := 0; i < n_headers; i++ {
+		_, seckey := cipher.GenerateKeyPair()
+		h := cipher.SumSHA256(secp256k1.RandByte(888))
+		b := &BlockBase{Sig: cipher.MustSignHash(h, seckey), Hash: h, Seqno: 1}
+		net.nodes[i%n_nodes].OnBlockHeaderArrived(b)
+	}
+	net.run()
+
+	pushed := 0
+	for i, p := range net.nodes {
+		stat := p.Get_gossip_stat()
+
+		p.mutex.Lock()
+		n_seen := p.seen_cache.Len()
+		p.mutex.Unlock()
+
+		if fanout == 0 && n_seen != n_headers {
+			t.Log("Node", i, "saw", n_seen, "of", n_headers, "headers.")
+			t.Fail()
+		}
+		if stat.Forwarded_count != n_seen {
+			t.Log("Node", i, "forwarded", stat.Forwarded_count,
+				"headers, expected each of", n_seen, "exactly once.")
+			t.Fail()
+		}
+		if fanout > 0 && stat.Pushed_count != fanout*n_seen {
+			t.Log("Node", i, "pushed", stat.Pushed_count, "messages.")
+			t.Fail()
+		}
+		pushed += stat.Pushed_count
+	}
+	if fanout > 0 && pushed != net.sent {
+		t.Log("Pushed_count", pushed, "does not match", net.sent, "messages sent.")
+		t.Fail()
+	}
+	return net
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestGossip_DuplicateSuppression(t *testing.T) {
+	n_nodes := 6
+	net := run_gossip(t, n_nodes, 0)
+
+	suppressed := 0
+	for _, p := range net.nodes {
+		suppressed += p.Get_gossip_stat().Duplicate_suppressed_count
+	}
+	// Each of the 5 headers is pushed once along each of the n*(n-1)
+	// edges; only n-1 of those deliveries are new to their receiver:
+	expected := 5 * (n_nodes*(n_nodes-1) - (n_nodes - 1))
+	if suppressed != expected {
+		t.Log("Duplicate_suppressed_count is", suppressed, "expected", expected)
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestGossip_Fanout(t *testing.T) {
+	n_nodes := 8
+	fanout := 3
+
+	all := run_gossip(t, n_nodes, 0)
+	some := run_gossip(t, n_nodes, fanout)
+
+	if some.sent >= all.sent {
+		t.Log("Fan-out did not reduce traffic:", some.sent, "vs", all.sent)
+		t.Fail()
+	}
+}
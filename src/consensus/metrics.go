@@ -0,0 +1,211 @@
+//nolint
+package consensus
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// Metrics of consensus progress and rejections. The counters are
+// updated under the participant's mutex; use Get_metrics() for a copy.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+// Labels for the return codes of on_block_header_arrived():
+var reject_reason_of_code = map[int]string{
+	1: "duplicate",
+	2: "max_candidate_messages",
+	3: "frozen",
+	4: "bad_sig",
+	5: "seqno_too_low",
+	6: "seqno_too_high",
+	7: "banned",
+	8: "rate_limited",
+	9: "peer_seqno_cap",
+}
+
+type Metrics struct {
+	Headers_received      uint64
+	Headers_accepted      uint64
+	Headers_forwarded     uint64 // Including our own votes and proposals
+	Pushes                uint64 // Individual sends, if fanning out
+	Duplicates_suppressed uint64 // By the seen-message cache
+
+	// Rejected headers, by reason (see reject_reason_of_code):
+	Rejections map[string]uint64
+
+	Votes_cast      uint64
+	Blocks_proposed uint64
+	Reorgs          uint64
+
+	// Commit latency: how many seqnos newer than the committed one had
+	// arrived, and how long since the committed seqno was first seen.
+	Blocks_committed           uint64
+	Commit_latency_seqnos_sum  uint64
+	Commit_latency_seconds_sum float64
+	Commit_latency_seconds_max float64
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *Metrics) Init() {
+	self.Rejections = make(map[string]uint64)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *Metrics) observe_result(res int) {
+	if res == 0 {
+		self.Headers_accepted += 1
+		return
+	}
+	reason, have := reject_reason_of_code[res]
+	if !have {
+		reason = fmt.Sprintf("code_%d", res)
+	}
+	self.Rejections[reason] += 1
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *Metrics) copy() Metrics {
+	c := *self
+	c.Rejections = make(map[string]uint64, len(self.Rejections))
+	for k, v := range self.Rejections {
+		c.Rejections[k] = v
+	}
+	return c
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *ConsensusParticipant) Get_metrics() Metrics {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return self.metrics.copy()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Candidates not yet decided, i.e. BlockStat entries that are not frozen.
+// Caller must hold self.mutex.
+func (self *ConsensusParticipant) get_candidate_queue_depth() int {
+	depth := 0
+	for _, statPtr := range self.block_stat_queue.queue {
+		if !statPtr.frozen {
+			depth++
+		}
+	}
+	return depth
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Writes the metrics in the Prometheus text exposition format.
+func (self *ConsensusParticipant) WritePrometheus(w io.Writer) error {
+	self.mutex.Lock()
+	m := self.metrics.copy()
+	queue_depth := self.get_candidate_queue_depth()
+	queue_len := len(self.block_stat_queue.queue)
+	tail_len := len(self.block_queue.blockPtr_slice)
+	next_seqno := self.block_queue.GetNextSeqNo()
+	self.mutex.Unlock()
+
+	pw := prometheus_writer{w: w}
+
+	pw.metric("obelisk_consensus_headers_received_total", "counter",
+		"Block headers received.", float64(m.Headers_received))
+	pw.metric("obelisk_consensus_headers_accepted_total", "counter",
+		"Block headers accepted as candidates.", float64(m.Headers_accepted))
+	pw.metric("obelisk_consensus_headers_forwarded_total", "counter",
+		"Block headers forwarded, including own votes and proposals.",
+		float64(m.Headers_forwarded))
+	pw.metric("obelisk_consensus_pushes_total", "counter",
+		"Individual sends to subscribers when fanning out.", float64(m.Pushes))
+	pw.metric("obelisk_consensus_duplicates_suppressed_total", "counter",
+		"Block headers dropped by the seen-message cache.",
+		float64(m.Duplicates_suppressed))
+
+	reasons := make([]string, 0, len(m.Rejections))
+	for reason, _ := range m.Rejections {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	pw.header("obelisk_consensus_headers_rejected_total", "counter",
+		"Block headers rejected, by reason.")
+	for _, reason := range reasons {
+		pw.sample(fmt.Sprintf("obelisk_consensus_headers_rejected_total{reason=%q}",
+			reason), float64(m.Rejections[reason]))
+	}
+
+	pw.metric("obelisk_consensus_votes_cast_total", "counter",
+		"Own votes signed and added to BlockStat.", float64(m.Votes_cast))
+	pw.metric("obelisk_consensus_blocks_proposed_total", "counter",
+		"Own block proposals.", float64(m.Blocks_proposed))
+	pw.metric("obelisk_consensus_reorgs_total", "counter",
+		"Reorganizations of BlockchainTail.", float64(m.Reorgs))
+
+	pw.header("obelisk_consensus_commit_latency_seqnos", "summary",
+		"Newer seqnos seen when a block was committed.")
+	pw.sample("obelisk_consensus_commit_latency_seqnos_sum",
+		float64(m.Commit_latency_seqnos_sum))
+	pw.sample("obelisk_consensus_commit_latency_seqnos_count",
+		float64(m.Blocks_committed))
+
+	pw.header("obelisk_consensus_commit_latency_seconds", "summary",
+		"Time from first seeing a seqno to committing it.")
+	pw.sample("obelisk_consensus_commit_latency_seconds_sum",
+		m.Commit_latency_seconds_sum)
+	pw.sample("obelisk_consensus_commit_latency_seconds_count",
+		float64(m.Blocks_committed))
+	pw.metric("obelisk_consensus_commit_latency_seconds_max", "gauge",
+		"Longest time from first seeing a seqno to committing it.",
+		m.Commit_latency_seconds_max)
+
+	pw.metric("obelisk_consensus_candidate_queue_depth", "gauge",
+		"Seqnos with candidates not yet decided.", float64(queue_depth))
+	pw.metric("obelisk_consensus_candidate_queue_length", "gauge",
+		"BlockStat entries held, including decided ones.", float64(queue_len))
+	pw.metric("obelisk_consensus_blockchain_tail_length", "gauge",
+		"Blocks held in BlockchainTail.", float64(tail_len))
+	pw.metric("obelisk_consensus_next_seqno", "gauge",
+		"Seqno of the next block to commit.", float64(next_seqno))
+
+	return pw.err
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func NewMetricsHandler(p *ConsensusParticipant) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		p.WritePrometheus(w)
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+type prometheus_writer struct {
+	w   io.Writer
+	err error
+}
+
+func (self *prometheus_writer) header(name string, kind string, help string) {
+	self.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func (self *prometheus_writer) sample(name string, value float64) {
+	self.printf("%s %g\n", name, value)
+}
+
+func (self *prometheus_writer) metric(name string, kind string, help string,
+	value float64) {
+
+	self.header(name, kind, help)
+	self.sample(name, value)
+}
+
+func (self *prometheus_writer) printf(format string, args ...interface{}) {
+	if self.err == nil {
+		_, self.err = fmt.Fprintf(self.w, format, args...)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
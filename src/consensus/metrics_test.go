@@ -0,0 +1,139 @@
+//nolint
+package consensus
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_Metrics(t *testing.T) {
+	n_signers := 2
+	n_seqno := 10
+
+	_, headers := make_signed_headers(n_signers, n_seqno)
+
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	p := NewConsensusParticipantPtr(&discardConnectionManager{}, NewRandomMemorySigner())
+	p.SetClock(clock.Now)
+
+	for seqno := 0; seqno < n_seqno; seqno++ {
+		for i := 0; i < n_signers; i++ {
+			p.OnBlockHeaderArrived(headers[i][seqno])
+		}
+		clock.Advance(time.Second)
+	}
+	p.OnBlockHeaderArrived(headers[0][0])                                   // Duplicate
+	p.OnBlockHeaderArrived(&BlockBase{Hash: headers[0][1].Hash, Seqno: 30}) // Seqno too high
+	p.OnBlockHeaderArrived(&BlockBase{Hash: headers[0][1].Hash, Seqno: 11}) // Bad sig
+
+	m := p.Get_metrics()
+
+	n_committed := uint64(n_seqno) - Cfg_consensus_waiting_time_as_seqno_diff
+	if m.Headers_received != uint64(n_signers*n_seqno+3) ||
+		m.Headers_accepted != uint64(n_signers*n_seqno) ||
+		m.Votes_cast != uint64(n_seqno) ||
+		m.Headers_forwarded != uint64((n_signers+1)*n_seqno) ||
+		m.Blocks_committed != n_committed {
+		t.Log("Metrics counters:", m)
+		t.Fail()
+	}
+	if m.Rejections["duplicate"] != 1 || m.Rejections["seqno_too_high"] != 1 ||
+		m.Rejections["bad_sig"] != 1 || m.Duplicates_suppressed != 1 {
+		t.Log("Metrics rejections:", m.Rejections)
+		t.Fail()
+	}
+	// Each seqno is committed once Cfg_consensus_waiting_time_as_seqno_diff
+	// newer seqnos arrived, one per (fake) second:
+	wait := Cfg_consensus_waiting_time_as_seqno_diff
+	if m.Commit_latency_seqnos_sum != n_committed*wait ||
+		m.Commit_latency_seconds_sum != float64(n_committed*wait) ||
+		m.Commit_latency_seconds_max != float64(wait) {
+		t.Log("Metrics commit latency:", m.Commit_latency_seqnos_sum,
+			m.Commit_latency_seconds_sum, m.Commit_latency_seconds_max)
+		t.Fail()
+	}
+
+	var buf bytes.Buffer
+	if err := p.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	text := buf.String()
+	for _, line := range []string{
+		"# TYPE obelisk_consensus_headers_received_total counter",
+		"obelisk_consensus_headers_received_total 23",
+		`obelisk_consensus_headers_rejected_total{reason="bad_sig"} 1`,
+		"obelisk_consensus_commit_latency_seqnos_count 3",
+		"obelisk_consensus_candidate_queue_depth 7",
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Log("Prometheus output lacks", line)
+			t.Fail()
+		}
+	}
+
+	server := httptest.NewServer(NewDebugHandler(p))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") ||
+		!strings.Contains(string(body), "obelisk_consensus_next_seqno 4\n") {
+		t.Log("/metrics returned", string(body))
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestMetrics_RateLimitReasons(t *testing.T) {
+	saved := Cfg_flood_burst
+	defer func() { Cfg_flood_burst = saved }()
+	Cfg_flood_burst = 1
+
+	p := NewWatchOnlyConsensusParticipantPtr(&discardConnectionManager{})
+	p.SetClock((&fakeClock{now: time.Unix(1000, 0)}).Now)
+
+	b := &BlockBase{Hash: cipher.SHA256{1}, Seqno: 1}
+	p.OnBlockHeaderArrivedFrom("peer", b)
+	p.OnBlockHeaderArrivedFrom("peer", b)
+
+	m := p.Get_metrics()
+	if m.Rejections["bad_sig"] != 1 || m.Rejections["rate_limited"] != 1 {
+		t.Log("Metrics rejections:", m.Rejections)
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestMetrics_VotesCastOnlyWhenAdded(t *testing.T) {
+	saved := Cfg_consensus_max_candidate_messages
+	defer func() { Cfg_consensus_max_candidate_messages = saved }()
+	// The first header of each seqno fills its BlockStat, so our own
+	// vote is signed but not added:
+	Cfg_consensus_max_candidate_messages = 1
+
+	const n_seqno = 3
+	_, headers := make_signed_headers(1, n_seqno)
+
+	p := NewConsensusParticipantPtr(&discardConnectionManager{}, NewRandomMemorySigner())
+	for seqno := 0; seqno < n_seqno; seqno++ {
+		p.OnBlockHeaderArrived(headers[0][seqno])
+	}
+
+	m := p.Get_metrics()
+	if m.Headers_accepted != n_seqno || m.Votes_cast != 0 {
+		t.Log("Metrics counted votes that were not added:", m.Headers_accepted, m.Votes_cast)
+		t.Fail()
+	}
+}
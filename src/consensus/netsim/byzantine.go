@@ -0,0 +1,192 @@
+//nolint
+package netsim
+
+import (
+	"fmt"
+
+	"github.com/adnan-mansoor-2015/obelisk/src/consensus"
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// Behaviour makes a node faulty. The hooks are called by the Network from
+// its single event loop; a faulty node still runs an honest
+// ConsensusParticipant underneath, unless its Behaviour keeps messages
+// from reaching it.
+//
+////////////////////////////////////////////////////////////////////////////////
+type Behaviour interface {
+	// Whether a message delivered to the node reaches its participant.
+	Receive(node *Node, from consensus.ConnectionKey, blockPtr *consensus.BlockBase) bool
+	// Whether a message of the participant to subscriber 'to' is sent.
+	Send(node *Node, to int, blockPtr *consensus.BlockBase) bool
+	// Called on the node's turn to propose. Returns false to withhold the
+	// honest proposal.
+	Propose(node *Node, round int, payload []byte) bool
+	// Called once every round, after the proposal, to inject messages.
+	Round(node *Node, round int)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Honest is a Behaviour that changes nothing, for faulty Behaviours to
+// embed and override.
+type Honest struct{}
+
+func (Honest) Receive(*Node, consensus.ConnectionKey, *consensus.BlockBase) bool { return true }
+func (Honest) Send(*Node, int, *consensus.BlockBase) bool                        { return true }
+func (Honest) Propose(*Node, int, []byte) bool                                   { return true }
+func (Honest) Round(*Node, int)                                                  {}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// SilentNode neither receives, sends nor proposes anything.
+//
+////////////////////////////////////////////////////////////////////////////////
+type SilentNode struct{ Honest }
+
+func (SilentNode) Receive(*Node, consensus.ConnectionKey, *consensus.BlockBase) bool { return false }
+func (SilentNode) Send(*Node, int, *consensus.BlockBase) bool                        { return false }
+func (SilentNode) Propose(*Node, int, []byte) bool                                   { return false }
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// SelectiveForwarder only sends to the subscribers in Targets, its own
+// proposals and votes included.
+//
+////////////////////////////////////////////////////////////////////////////////
+type SelectiveForwarder struct {
+	Honest
+	Targets map[int]bool // By node index
+}
+
+func NewSelectiveForwarder(targets ...int) *SelectiveForwarder {
+	self := &SelectiveForwarder{Targets: make(map[int]bool)}
+	for _, to := range targets {
+		self.Targets[to] = true
+	}
+	return self
+}
+
+func (self *SelectiveForwarder) Send(node *Node, to int, blockPtr *consensus.BlockBase) bool {
+	return self.Targets[to]
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// EquivocatingSigner proposes two different blocks for the same seqno on
+// its turn, one to the first Split subscribers and the other to the rest.
+// Split is 0 for a third of them.
+//
+////////////////////////////////////////////////////////////////////////////////
+type EquivocatingSigner struct {
+	Honest
+	Split int
+
+	Equivocation_count int
+}
+
+func (self *EquivocatingSigner) Propose(node *Node, round int, payload []byte) bool {
+	seqno := node.Participant.GetNextProposalSeqNo()
+	a, err_a := signed_header(node, seqno, cipher.SumSHA256(payload))
+	b, err_b := signed_header(node, seqno,
+		cipher.SumSHA256(append([]byte("equivocation "), payload...)))
+	if err_a != nil || err_b != nil {
+		return true // Cannot sign, so cannot equivocate either
+	}
+
+	subscribers := node.GetSubscribers()
+	split := self.Split
+	if split <= 0 {
+		split = (len(subscribers) + 2) / 3
+	}
+	for i, to := range subscribers {
+		if i < split {
+			node.Transmit(to, a)
+		} else {
+			node.Transmit(to, b)
+		}
+	}
+	self.Equivocation_count++
+	return false
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// SeqnoSpammer sends Count validly signed headers every round, for
+// seqnos just beyond what its peers accept. It starts the round after it
+// first sees a block, as a participant with no candidates yet accepts any
+// seqno.
+//
+////////////////////////////////////////////////////////////////////////////////
+type SeqnoSpammer struct {
+	Honest
+	Count int
+
+	Spam_count int
+	armed      bool
+}
+
+func (self *SeqnoSpammer) Round(node *Node, round int) {
+	if !self.armed {
+		self.armed = node.Participant.Get_block_stat_queue_Len() > 0
+		return
+	}
+	first := node.Participant.GetNextProposalSeqNo() +
+		consensus.Cfg_consensus_candidate_max_seqno_gap + 1
+
+	for k := 0; k < self.Count; k++ {
+		seqno := first + uint64(k)
+		hash := cipher.SumSHA256([]byte(fmt.Sprintf("spam %d %d", round, k)))
+		blockPtr, err := signed_header(node, seqno, hash)
+		if err != nil {
+			return
+		}
+		for _, to := range node.subscribers {
+			node.Transmit(to, blockPtr)
+			self.Spam_count++
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// InvalidSigFlooder sends Count headers with invalid signatures every
+// round, for the seqno its peers expect next.
+//
+////////////////////////////////////////////////////////////////////////////////
+type InvalidSigFlooder struct {
+	Honest
+	Count int
+
+	Flood_count int
+}
+
+func (self *InvalidSigFlooder) Round(node *Node, round int) {
+	seqno := node.Participant.GetNextProposalSeqNo()
+	for k := 0; k < self.Count; k++ {
+		blockPtr := &consensus.BlockBase{
+			Hash:  cipher.SumSHA256([]byte(fmt.Sprintf("flood %d %d", round, k))),
+			Seqno: seqno,
+		} // Empty '.Sig' is invalid
+		for _, to := range node.subscribers {
+			node.Transmit(to, blockPtr)
+			self.Flood_count++
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func signed_header(
+	node *Node,
+	seqno uint64,
+	hash cipher.SHA256) (*consensus.BlockBase, error) {
+
+	sig, err := node.Participant.SignatureOf(hash)
+	if err != nil {
+		return nil, err
+	}
+	return &consensus.BlockBase{Sig: sig, Hash: hash, Seqno: seqno}, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
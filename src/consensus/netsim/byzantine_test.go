@@ -0,0 +1,142 @@
+//nolint
+package netsim
+
+import (
+	"testing"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// 7 fully connected nodes, so that one or two faulty ones are a minority.
+func byzantine_config(behaviours map[int]Behaviour) Config {
+	cfg := default_config()
+	cfg.Nodes = 7
+	cfg.Subscribers = 0
+	cfg.Rounds = 21
+	cfg.Behaviours = behaviours
+	return cfg
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// 'lost' blocks of the 21 proposed may be missing.
+func check_honest_agreement(t *testing.T, r *Report, lost int) {
+	if !r.Agreed {
+		t.Log("Honest nodes did not agree:", r.String())
+		t.Fail()
+	}
+	// The last Cfg_consensus_waiting_time_as_seqno_diff blocks never ripen:
+	if r.Common_seqno+7+uint64(r.Proposals_withheld+lost) < 21 {
+		t.Log("Honest nodes committed too little:", r.String())
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestByzantine_SilentNode(t *testing.T) {
+	r := run(t, byzantine_config(map[int]Behaviour{
+		2: SilentNode{},
+		5: SilentNode{},
+	}))
+	check_honest_agreement(t, r, 0)
+
+	if r.Proposals_withheld != 6 {
+		t.Log("Silent nodes did not withhold their proposals:", r.String())
+		t.Fail()
+	}
+	if len(r.Tails[2]) != 0 || len(r.Tails[5]) != 0 {
+		t.Log("Silent nodes committed blocks.")
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestByzantine_SelectiveForwarder(t *testing.T) {
+	r := run(t, byzantine_config(map[int]Behaviour{
+		1: NewSelectiveForwarder(2),
+		4: NewSelectiveForwarder(),
+	}))
+	// Nobody hears the proposals of node 4:
+	check_honest_agreement(t, r, 3)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestByzantine_EquivocatingSigner(t *testing.T) {
+	equivocator := &EquivocatingSigner{}
+	r := run(t, byzantine_config(map[int]Behaviour{3: equivocator}))
+	check_honest_agreement(t, r, 0)
+
+	if equivocator.Equivocation_count != 3 {
+		t.Log("Equivocation_count is", equivocator.Equivocation_count)
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestByzantine_SeqnoSpammer(t *testing.T) {
+	spammer := &SeqnoSpammer{Count: 5}
+	net, err := NewNetwork(byzantine_config(map[int]Behaviour{0: spammer}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := net.Run()
+	check_honest_agreement(t, r, 0)
+
+	if spammer.Spam_count == 0 {
+		t.Log("SeqnoSpammer sent nothing.")
+		t.Fail()
+	}
+	// None of the spam made it into the candidates of honest nodes:
+	for _, node := range net.Nodes[1:] {
+		for _, stat := range node.Participant.Snapshot().Candidates {
+			if stat.Seqno > r.Common_seqno+7 {
+				t.Log("Node", node.Index, "accepted spam for seqno", stat.Seqno)
+				t.Fail()
+			}
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestByzantine_InvalidSigFlooder(t *testing.T) {
+	flooder := &InvalidSigFlooder{Count: 5}
+	net, err := NewNetwork(byzantine_config(map[int]Behaviour{6: flooder}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := net.Run()
+	// Once banned, the proposals of the flooder are ignored too:
+	check_honest_agreement(t, r, 3)
+
+	for _, node := range net.Nodes[:6] {
+		if !node.Participant.IsBanned(net.Nodes[6].Key) {
+			t.Log("Node", node.Index, "did not ban the flooder.")
+			t.Fail()
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestByzantine_Mixed(t *testing.T) {
+	cfg := byzantine_config(map[int]Behaviour{
+		0: &EquivocatingSigner{},
+		3: SilentNode{},
+	})
+	cfg.Nodes = 10
+	cfg.Subscribers = 5
+	cfg.Rounds = 30
+	cfg.Behaviours[5] = &SeqnoSpammer{Count: 3}
+	cfg.Behaviours[7] = &InvalidSigFlooder{Count: 3}
+	cfg.Behaviours[8] = NewSelectiveForwarder(0, 1)
+
+	r := run(t, cfg)
+	if !r.Agreed || r.Common_seqno < 15 {
+		t.Log("Honest nodes did not agree:", r.String())
+		t.Fail()
+	}
+
+	if _, err := NewNetwork(byzantine_config(map[int]Behaviour{7: SilentNode{}})); err == nil {
+		t.Log("NewNetwork() accepted a behaviour for an unknown node.")
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,461 @@
+//nolint
+// Package netsim is a deterministic, seeded discrete-event harness that
+// runs ConsensusParticipants over a simulated network with latency,
+// jitter, message drops and reordering.
+package netsim
+
+import (
+	"container/heap"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/adnan-mansoor-2015/obelisk/src/consensus"
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// # Config
+//
+////////////////////////////////////////////////////////////////////////////////
+type Config struct {
+	Nodes       int
+	Subscribers int   // Per node, picked at random; 0 means all other nodes
+	Seed        int64 // Same seed, same run
+
+	// Every message takes Latency plus up to Jitter. With probability
+	// Reorder_rate it takes Reorder_delay more, so that later messages
+	// overtake it. With probability Drop_rate it is lost.
+	Latency       time.Duration
+	Jitter        time.Duration
+	Reorder_rate  float64
+	Reorder_delay time.Duration
+	Drop_rate     float64
+
+	// One block is proposed every Round_interval, round-robin over the
+	// nodes, for Rounds rounds.
+	Rounds         int
+	Round_interval time.Duration
+
+	// Faulty nodes, by node index. Nodes not listed are honest.
+	Behaviours map[int]Behaviour
+
+	// Events scheduled after this much simulated time are not run.
+	// Zero means run until no events are left.
+	Max_time time.Duration
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// # Report
+//
+////////////////////////////////////////////////////////////////////////////////
+type Report struct {
+	// True if all honest nodes ended with identical, non-empty
+	// BlockchainTails. Only the blocks held by all of them are compared.
+	Agreed bool
+	// When the last honest node committed its last block. Only if Agreed.
+	Agreed_at time.Duration
+	// Seqno up to which all honest nodes committed the same hashes.
+	Common_seqno uint64
+
+	Messages_sent      int
+	Messages_dropped   int
+	Messages_delivered int
+	Proposals_failed   int
+	Proposals_withheld int // By faulty nodes, on their turn
+
+	// Per node, faulty ones included, the committed blocks still held,
+	// oldest first:
+	Tails [][]consensus.BlockSnapshot
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *Report) String() string {
+	return fmt.Sprintf("Report={agreed=%t,agreed_at=%s,common_seqno=%d,"+
+		"sent=%d,dropped=%d,delivered=%d,proposals_failed=%d,"+
+		"proposals_withheld=%d}",
+		self.Agreed, self.Agreed_at, self.Common_seqno, self.Messages_sent,
+		self.Messages_dropped, self.Messages_delivered, self.Proposals_failed,
+		self.Proposals_withheld)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// Events, ordered by time, then by scheduling order.
+//
+////////////////////////////////////////////////////////////////////////////////
+type event struct {
+	at  time.Duration
+	seq uint64
+	run func()
+}
+
+type event_queue []*event
+
+func (q event_queue) Len() int { return len(q) }
+func (q event_queue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].seq < q[j].seq
+}
+func (q event_queue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *event_queue) Push(x interface{}) { *q = append(*q, x.(*event)) }
+func (q *event_queue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return e
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// Node is one participant with its simulated connection manager.
+//
+////////////////////////////////////////////////////////////////////////////////
+type Node struct {
+	Index       int
+	Key         consensus.ConnectionKey
+	Participant *consensus.ConsensusParticipant
+	Behaviour   Behaviour // nil if honest
+
+	net         *Network
+	subscribers []int
+
+	// When each seqno was committed, for the report:
+	commit_times []time.Duration
+}
+
+func (self *Node) Print() {
+	fmt.Printf("netsim.Node={index=%d,subscribers=%v}", self.Index, self.subscribers)
+}
+
+func (self *Node) SendBlockToAllMySubscriber(blockPtr *consensus.BlockBase) {
+	for _, to := range self.subscribers {
+		self.net.send(self.Index, to, blockPtr)
+	}
+}
+
+func (self *Node) GetSubscriberKeys() []consensus.ConnectionKey {
+	keys := make([]consensus.ConnectionKey, 0, len(self.subscribers))
+	for _, to := range self.subscribers {
+		keys = append(keys, self.net.Nodes[to].Key)
+	}
+	return keys
+}
+
+func (self *Node) SendBlockToSubscriber(
+	key consensus.ConnectionKey,
+	blockPtr *consensus.BlockBase) {
+
+	for _, to := range self.subscribers {
+		if self.net.Nodes[to].Key == key {
+			self.net.send(self.Index, to, blockPtr)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Sends to subscriber 'to', bypassing the node's Behaviour. For faulty
+// nodes to inject messages of their own.
+func (self *Node) Transmit(to int, blockPtr *consensus.BlockBase) {
+	self.net.transmit(self.Index, to, blockPtr)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *Node) GetSubscribers() []int {
+	return append([]int(nil), self.subscribers...)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *Node) IsHonest() bool {
+	return self.Behaviour == nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Records commit times of the seqnos committed since the last call.
+func (self *Node) observe_commits(now time.Duration) {
+	next := self.Participant.GetNextBlockSeqNo()
+	for uint64(len(self.commit_times))+1 < next {
+		self.commit_times = append(self.commit_times, now)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// # Network
+//
+////////////////////////////////////////////////////////////////////////////////
+type Network struct {
+	Config Config
+	Nodes  []*Node
+
+	rand   *rand.Rand // The only source of randomness of the simulation
+	now    time.Duration
+	epoch  time.Time // Wall-clock time shown to the participants at 'now' == 0
+	events event_queue
+	seq    uint64
+
+	report Report
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func NewNetwork(cfg Config) (*Network, error) {
+	if cfg.Nodes < 1 {
+		return nil, fmt.Errorf("netsim: need at least 1 node, got %d", cfg.Nodes)
+	}
+	if cfg.Subscribers < 0 || cfg.Subscribers >= cfg.Nodes {
+		return nil, fmt.Errorf("netsim: subscribers must be in [0,%d), got %d",
+			cfg.Nodes, cfg.Subscribers)
+	}
+
+	self := &Network{
+		Config: cfg,
+		rand:   rand.New(rand.NewSource(cfg.Seed)),
+		epoch:  time.Unix(0, 0).UTC(),
+	}
+
+	for i := 0; i < cfg.Nodes; i++ {
+		node := &Node{
+			Index:     i,
+			Key:       consensus.ConnectionKey(fmt.Sprintf("node-%d", i)),
+			Behaviour: cfg.Behaviours[i],
+			net:       self,
+		}
+		node.Participant = consensus.NewConsensusParticipantPtr(node,
+			self.new_signer())
+		node.Participant.SetClock(self.Now)
+		node.Participant.SetRand(rand.New(rand.NewSource(self.rand.Int63())))
+		self.Nodes = append(self.Nodes, node)
+	}
+
+	for _, node := range self.Nodes {
+		node.subscribers = self.pick_subscribers(node.Index)
+	}
+
+	for i := range cfg.Behaviours {
+		if i < 0 || i >= cfg.Nodes {
+			return nil, fmt.Errorf("netsim: behaviour for unknown node %d", i)
+		}
+	}
+
+	return self, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *Network) new_signer() consensus.Signer {
+	seed := make([]byte, 32)
+	self.rand.Read(seed)
+	_, seckey := cipher.MustGenerateDeterministicKeyPair(seed)
+	signer, err := consensus.NewMemorySigner(seckey)
+	if err != nil {
+		panic(err) // Deterministic keys are always valid
+	}
+	return signer
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *Network) pick_subscribers(index int) []int {
+	var subscribers []int
+	if self.Config.Subscribers == 0 {
+		for i := 0; i < self.Config.Nodes; i++ {
+			if i != index {
+				subscribers = append(subscribers, i)
+			}
+		}
+		return subscribers
+	}
+
+	for _, i := range self.rand.Perm(self.Config.Nodes) {
+		if i != index && len(subscribers) < self.Config.Subscribers {
+			subscribers = append(subscribers, i)
+		}
+	}
+	return subscribers
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// The simulated wall-clock time, as seen by the participants.
+func (self *Network) Now() time.Time {
+	return self.epoch.Add(self.now)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *Network) schedule(delay time.Duration, run func()) {
+	self.seq++
+	heap.Push(&self.events, &event{at: self.now + delay, seq: self.seq, run: run})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *Network) send(from int, to int, blockPtr *consensus.BlockBase) {
+	node := self.Nodes[from]
+	if node.Behaviour != nil && !node.Behaviour.Send(node, to, blockPtr) {
+		return
+	}
+	self.transmit(from, to, blockPtr)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *Network) transmit(from int, to int, blockPtr *consensus.BlockBase) {
+	self.report.Messages_sent++
+
+	if self.rand.Float64() < self.Config.Drop_rate {
+		self.report.Messages_dropped++
+		return
+	}
+
+	delay := self.Config.Latency
+	if self.Config.Jitter > 0 {
+		delay += time.Duration(self.rand.Int63n(int64(self.Config.Jitter) + 1))
+	}
+	if self.rand.Float64() < self.Config.Reorder_rate {
+		delay += self.Config.Reorder_delay
+	}
+
+	key := self.Nodes[from].Key
+	// Each receiver gets its own copy, as it would off the wire:
+	copyPtr := &consensus.BlockBase{}
+	*copyPtr = *blockPtr
+
+	self.schedule(delay, func() {
+		self.report.Messages_delivered++
+		node := self.Nodes[to]
+		if node.Behaviour != nil && !node.Behaviour.Receive(node, key, copyPtr) {
+			return
+		}
+		node.Participant.OnBlockHeaderArrivedFrom(key, copyPtr)
+		node.observe_commits(self.now)
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *Network) schedule_proposals() {
+	for round := 0; round < self.Config.Rounds; round++ {
+		round := round
+		self.schedule(time.Duration(round)*self.Config.Round_interval, func() {
+			payload := []byte(fmt.Sprintf("netsim seed %d round %d", self.Config.Seed, round))
+			self.propose(self.Nodes[round%len(self.Nodes)], round, payload)
+
+			for _, node := range self.Nodes {
+				if node.Behaviour != nil {
+					node.Behaviour.Round(node, round)
+				}
+			}
+		})
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *Network) propose(node *Node, round int, payload []byte) {
+	if node.Behaviour != nil && !node.Behaviour.Propose(node, round, payload) {
+		self.report.Proposals_withheld++
+		return
+	}
+	if _, err := node.Participant.ProposeBlock(payload); err != nil {
+		self.report.Proposals_failed++
+		return
+	}
+	node.observe_commits(self.now)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Runs the simulation to the end and reports on it. A Network can only
+// be run once.
+func (self *Network) Run() *Report {
+	self.schedule_proposals()
+
+	for self.events.Len() > 0 {
+		e := heap.Pop(&self.events).(*event)
+		if self.Config.Max_time > 0 && e.at > self.Config.Max_time {
+			break
+		}
+		self.now = e.at
+		e.run()
+	}
+
+	self.finish_report()
+	return &self.report
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *Network) finish_report() {
+	r := &self.report
+
+	// Only the most recent blocks are held, so compare by seqno from the
+	// oldest seqno that all honest nodes still hold:
+	var honest [][]consensus.BlockSnapshot
+	first, last := uint64(1), ^uint64(0)
+	for _, node := range self.Nodes {
+		tail := node.Participant.Snapshot().Tail
+		r.Tails = append(r.Tails, tail)
+		if !node.IsHonest() {
+			continue
+		}
+		honest = append(honest, tail)
+		if len(tail) == 0 {
+			first, last = 1, 0
+			continue
+		}
+		if tail[0].Seqno > first {
+			first = tail[0].Seqno
+		}
+		if tail[len(tail)-1].Seqno < last {
+			last = tail[len(tail)-1].Seqno
+		}
+	}
+
+	r.Common_seqno = 0
+	if len(honest) == 0 {
+		return
+	}
+	for seqno := first; seqno <= last; seqno++ {
+		hash := hash_at(honest[0], seqno)
+		same := true
+		for _, tail := range honest[1:] {
+			if hash_at(tail, seqno) != hash {
+				same = false
+				break
+			}
+		}
+		if !same {
+			break
+		}
+		r.Common_seqno = seqno
+	}
+
+	r.Agreed = r.Common_seqno > 0
+	for _, tail := range honest {
+		if len(tail) == 0 || tail[len(tail)-1].Seqno != r.Common_seqno {
+			r.Agreed = false
+			break
+		}
+	}
+	if r.Agreed {
+		for _, node := range self.Nodes {
+			if !node.IsHonest() {
+				continue
+			}
+			if at := node.commit_times[r.Common_seqno-1]; at > r.Agreed_at {
+				r.Agreed_at = at
+			}
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func hash_at(tail []consensus.BlockSnapshot, seqno uint64) string {
+	if len(tail) == 0 || seqno < tail[0].Seqno {
+		return ""
+	}
+	i := seqno - tail[0].Seqno
+	if i >= uint64(len(tail)) {
+		return ""
+	}
+	return tail[i].Hash
+}
+
+////////////////////////////////////////////////////////////////////////////////
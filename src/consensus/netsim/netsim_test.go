@@ -0,0 +1,113 @@
+//nolint
+package netsim
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adnan-mansoor-2015/obelisk/src/consensus"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+func default_config() Config {
+	return Config{
+		Nodes:          6,
+		Subscribers:    3,
+		Seed:           7,
+		Latency:        50 * time.Millisecond,
+		Jitter:         30 * time.Millisecond,
+		Rounds:         20,
+		Round_interval: time.Second,
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func run(t *testing.T, cfg Config) *Report {
+	net, err := NewNetwork(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return net.Run()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestNetwork_Agreement(t *testing.T) {
+	cfg := default_config()
+	r := run(t, cfg)
+
+	if !r.Agreed || r.Proposals_failed != 0 || r.Messages_dropped != 0 {
+		t.Fatal("Honest nodes did not agree:", r.String())
+	}
+	// The last Cfg_consensus_waiting_time_as_seqno_diff blocks never ripen:
+	if r.Common_seqno != 13 {
+		t.Log("Common_seqno is", r.Common_seqno)
+		t.Fail()
+	}
+	// Seqno 13 ripens when seqno 20 is proposed, at 19 seconds:
+	if r.Agreed_at < 19*time.Second || r.Agreed_at > 20*time.Second {
+		t.Log("Agreed_at is", r.Agreed_at)
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Signing uses a random nonce, so only what was signed is reproducible.
+func unsigned(tails [][]consensus.BlockSnapshot) [][]consensus.BlockSnapshot {
+	var res [][]consensus.BlockSnapshot
+	for _, tail := range tails {
+		var blocks []consensus.BlockSnapshot
+		for _, b := range tail {
+			b.Sig = ""
+			blocks = append(blocks, b)
+		}
+		res = append(res, blocks)
+	}
+	return res
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestNetwork_Deterministic(t *testing.T) {
+	cfg := default_config()
+	cfg.Drop_rate = 0.2
+	cfg.Reorder_rate = 0.3
+	cfg.Reorder_delay = 500 * time.Millisecond
+
+	r1 := run(t, cfg)
+	r2 := run(t, cfg)
+	if !r1.Agreed {
+		t.Log("Nothing to compare:", r1.String())
+		t.Fail()
+	}
+
+	if !reflect.DeepEqual(unsigned(r1.Tails), unsigned(r2.Tails)) ||
+		r1.String() != r2.String() {
+		t.Log("Same seed, different runs:", r1.String(), r2.String())
+		t.Fail()
+	}
+
+	cfg.Seed++
+	r3 := run(t, cfg)
+	if r1.Messages_dropped == r3.Messages_dropped &&
+		r1.Messages_delivered == r3.Messages_delivered {
+		t.Log("Different seeds, same run:", r1.String(), r3.String())
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestNetwork_Config(t *testing.T) {
+	cfg := default_config()
+	cfg.Subscribers = cfg.Nodes
+	if _, err := NewNetwork(cfg); err == nil {
+		t.Log("NewNetwork() accepted too many subscribers.")
+		t.Fail()
+	}
+
+	cfg = default_config()
+	cfg.Max_time = 5 * time.Second
+	if r := run(t, cfg); r.Agreed {
+		t.Log("Max_time did not stop the run early:", r.String())
+		t.Fail()
+	}
+}
@@ -5,7 +5,11 @@
 package consensus
 
 import (
+	"errors"
 	"fmt"
+	"math/rand"
+	"sync"
+	"time"
 
 	"github.com/skycoin/skycoin/src/cipher"
 )
@@ -16,10 +20,18 @@ import (
 // github.com/skycoin/skycoin/src/mesh*/node struct Node, so that
 // Node can participate in consensus.
 //
+// The methods of ConsensusParticipant are safe for concurrent use, so
+// the networking layer may deliver headers from several goroutines.
+// BlockchainTail, BlockStatQueue, BlockStat and HashCandidate are not;
+// they are only accessed while holding the participant's mutex.
+//
 ////////////////////////////////////////////////////////////////////////////////
 type ConsensusParticipant struct {
-	Pubkey cipher.PubKey // Who we are
-	Seckey cipher.SecKey // For signing
+	// Guards all fields below, including the queues and their maps.
+	mutex sync.Mutex
+
+	Pubkey cipher.PubKey // Who we are; all-zero if watch-only
+	signer Signer        // For signing; nil if watch-only
 
 	pConnectionManager ConnectionManagerInterface
 
@@ -29,7 +41,30 @@ type ConsensusParticipant struct {
 	// Candidates Blocks.
 	block_stat_queue BlockStatQueue
 
-	Incoming_block_count int
+	// Per-connection accounting for OnBlockHeaderArrivedFrom().
+	flood_guard FloodGuard
+
+	// The hash we signed for each seqno that is not yet frozen. We never
+	// sign two different hashes for the same seqno.
+	seqno2vote map[uint64]cipher.SHA256
+
+	// Highest seqno ever frozen. We never vote at or below it, even if
+	// a reorganization unfreezes BlockStat entries.
+	max_frozen_seqno uint64
+
+	// Called after a reorganization of BlockchainTail.
+	reorg_handler func(ReorgEvent)
+
+	// Who may call ProposeBlock() for which seqno.
+	proposer_schedule ProposerSchedule
+
+	// Recently accepted (hash,sig) pairs, not to be forwarded again.
+	seen_cache SeenCache
+
+	clock func() time.Time
+	rand  *rand.Rand // For picking subscribers when fanning out
+
+	metrics Metrics
 }
 
 func (self *ConsensusParticipant) GetConnectionManager() ConnectionManagerInterface {
@@ -38,22 +73,97 @@ func (self *ConsensusParticipant) GetConnectionManager() ConnectionManagerInterf
 
 ////////////////////////////////////////////////////////////////////////////////
 func (self *ConsensusParticipant) GetNextBlockSeqNo() uint64 {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
 	return self.block_queue.GetNextSeqNo()
 }
 
 ////////////////////////////////////////////////////////////////////////////////
-func (self *ConsensusParticipant) SetPubkeySeckey(
-	pubkey cipher.PubKey,
-	seckey cipher.SecKey) {
+func (self *ConsensusParticipant) Get_Incoming_block_count() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return int(self.metrics.Headers_received)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// The clock is used for rate limiting and banning. Tests and simulations
+// may replace time.Now with their own clock.
+func (self *ConsensusParticipant) SetClock(clock func() time.Time) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.clock = clock
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Replaces the source of randomness used for picking subscribers, so
+// that simulations can be made reproducible.
+func (self *ConsensusParticipant) SetRand(r *rand.Rand) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.rand = r
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *ConsensusParticipant) Get_gossip_stat() GossipStat {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return GossipStat{
+		Duplicate_suppressed_count: int(self.metrics.Duplicates_suppressed),
+		Forwarded_count:            int(self.metrics.Headers_forwarded),
+		Pushed_count:               int(self.metrics.Pushes),
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *ConsensusParticipant) IsBanned(key ConnectionKey) bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
 
-	self.Pubkey, self.Seckey = pubkey, seckey
-	//self.pConnectionManager.SetPubkey(pubkey)
+	return self.flood_guard.IsBanned(key, self.clock())
+}
+
+////////////////////////////////////////////////////////////////////////////////
+var ErrWatchOnly = errors.New("consensus: watch-only participant cannot sign")
+
+////////////////////////////////////////////////////////////////////////////////
+// A nil signer makes the participant watch-only: it still tracks and
+// relays headers and builds its BlockchainTail, but it never signs.
+func (self *ConsensusParticipant) SetSigner(signer Signer) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if signer == nil {
+		self.Pubkey, self.signer = cipher.PubKey{}, nil
+		return
+	}
+	self.Pubkey, self.signer = signer.GetPubkey(), signer
+	//self.pConnectionManager.SetPubkey(self.Pubkey)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *ConsensusParticipant) IsWatchOnly() bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return self.signer == nil
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 func (self *ConsensusParticipant) Print() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	pubkey_str := "watch-only"
+	if self.signer != nil {
+		pubkey_str = self.Pubkey.Hex()[:8]
+	}
 	fmt.Printf("ConsensusParticipant={pubkey=%s,block_msg_count=%d,",
-		self.Pubkey.Hex()[:8], self.Incoming_block_count)
+		pubkey_str, self.metrics.Headers_received)
 
 	self.pConnectionManager.Print()
 
@@ -69,62 +179,306 @@ func (self *ConsensusParticipant) Print() {
 }
 
 ////////////////////////////////////////////////////////////////////////////////
-func NewConsensusParticipantPtr(pMan ConnectionManagerInterface) *ConsensusParticipant {
+// In PROD: the signer comes from FileKeystore.Unlock(). In SIMU:
+// NewRandomMemorySigner(). In case the participant does not expect to
+// sign anything, use NewWatchOnlyConsensusParticipantPtr().
+func NewConsensusParticipantPtr(
+	pMan ConnectionManagerInterface,
+	signer Signer) *ConsensusParticipant {
 
 	node := ConsensusParticipant{
-		pConnectionManager:   pMan,
-		block_queue:          BlockchainTail{},
-		Incoming_block_count: 0,
+		pConnectionManager: pMan,
+		block_queue:        BlockchainTail{},
+		proposer_schedule:  AnyProposer{},
+		clock:              time.Now,
+		rand:               rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 	node.block_queue.Init()
+	node.flood_guard.Init()
+	node.metrics.Init()
+	node.seen_cache.Init()
+	node.seqno2vote = make(map[uint64]cipher.SHA256)
 	//node.block_stat_queue.Init()
 
-	// In PROD: each reads/loads the keys. In case the class does not
-	// expect to sign anything, SecKey should not be stored.
-
-	// In SIMU: generate random keys.
-	node.SetPubkeySeckey(cipher.GenerateKeyPair())
+	node.SetSigner(signer)
 
 	return &node
 }
 
 ////////////////////////////////////////////////////////////////////////////////
-// Reasons for this function: 1st, we want to minimize exposure of
-// SecKey, even in same process space.  2nd, functions Sign and
-// SignHash already exists, so want keep search/browse/jump-to-tag
-// unambiguous.
-func (self *ConsensusParticipant) SignatureOf(hash cipher.SHA256) cipher.Sig {
+func NewWatchOnlyConsensusParticipantPtr(
+	pMan ConnectionManagerInterface) *ConsensusParticipant {
+
+	return NewConsensusParticipantPtr(pMan, nil)
+}
 
-	// PERFORMANCE: This is expensive when cipher.DebugLevel2 or
-	// cipher.DebugLevel1 are true:
-	return cipher.MustSignHash(hash, self.Seckey)
+////////////////////////////////////////////////////////////////////////////////
+// Reasons for this function: 1st, we want to minimize exposure of
+// SecKey, even in same process space, so signing is delegated to the
+// Signer.  2nd, functions Sign and SignHash already exists, so want
+// keep search/browse/jump-to-tag unambiguous.
+func (self *ConsensusParticipant) SignatureOf(hash cipher.SHA256) (cipher.Sig, error) {
+	self.mutex.Lock()
+	signer := self.signer
+	self.mutex.Unlock()
+
+	if signer == nil {
+		return cipher.Sig{}, ErrWatchOnly
+	}
+	return signer.SignHash(hash)
 }
 
 ////////////////////////////////////////////////////////////////////////////////
 func (self *ConsensusParticipant) Get_block_stat_queue_Len() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
 	return self.block_stat_queue.Len()
 }
 
 ////////////////////////////////////////////////////////////////////////////////
+// The returned BlockStat keeps changing as headers arrive, so the caller
+// must not use it concurrently with OnBlockHeaderArrived().
 func (self *ConsensusParticipant) Get_block_stat_queue_element_at(
 	j int) *BlockStat {
 
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
 	return self.block_stat_queue.queue[j] // A pointer, BTW
 }
 
 ////////////////////////////////////////////////////////////////////////////////
+// For headers of unknown or local origin. These are not subject to the
+// per-connection limits; use OnBlockHeaderArrivedFrom() for network input.
 func (self *ConsensusParticipant) OnBlockHeaderArrived(blockPtr *BlockBase) {
+	self.on_block_header_arrived("", blockPtr)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *ConsensusParticipant) OnBlockHeaderArrivedFrom(
+	key ConnectionKey,
+	blockPtr *BlockBase) {
+
+	self.on_block_header_arrived(key, blockPtr)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Return codes: those of FloodGuard.try_admit() and
+// BlockStatQueue.try_append_to_BlockStatQueue().
+func (self *ConsensusParticipant) on_block_header_arrived(
+	key ConnectionKey,
+	blockPtr *BlockBase) int {
+
+	self.mutex.Lock()
+
+	self.metrics.Headers_received += 1
+
+	now := self.clock()
+	banned := false
+	var banned_until time.Time
+
+	res1 := 0
+	if key != "" {
+		low, high, window := self.block_stat_queue.get_seqno_window()
+		res1 = self.flood_guard.try_admit(
+			key, blockPtr.Seqno, low, high, window, now)
+	}
+	if res1 == 0 && self.seen_cache.Has(blockPtr.Hash, blockPtr.Sig) {
+		self.metrics.Duplicates_suppressed += 1
+		res1 = 1 // Duplicate (hash,sig)
+	}
+	if res1 == 0 {
+		res1 = self.block_stat_queue.try_append_to_BlockStatQueue(blockPtr)
+		if res1 == 4 && key != "" {
+			banned = self.flood_guard.observe_invalid_sig(key, now)
+			banned_until = self.flood_guard.get_banned_until(key)
+		}
+	}
+	if res1 == 0 {
+		// Invalid messages are not remembered, so that every copy
+		// counts towards banning its sender.
+		self.on_appended(blockPtr, now)
+	}
+	self.metrics.observe_result(res1)
 
-	self.Incoming_block_count += 1 // TODO: move this to try_add_hash_and_sig
+	self.mutex.Unlock()
 
-	res1 := self.block_stat_queue.try_append_to_BlockStatQueue(blockPtr)
+	// Call out without holding the mutex: an in-process connection
+	// manager may deliver straight back into OnBlockHeaderArrived().
+	if banned {
+		if pBanner, ok := self.pConnectionManager.(ConnectionBannerInterface); ok {
+			pBanner.BanConnection(key, banned_until)
+		}
+	}
 	if res1 == 0 {
-		self.harvest_ripe_BlockStat()
+		self.forward_block(blockPtr)
+		self.cast_vote(blockPtr.Seqno)
+	}
+
+	return res1
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Signs our preferred hash for 'seqno', unless we already did, adds the
+// vote to our own BlockStat and gossips it.
+// Caller must not hold self.mutex.
+func (self *ConsensusParticipant) cast_vote(seqno uint64) {
+
+	self.mutex.Lock()
+	hash, ok := self.choose_vote(seqno)
+	signer := self.signer
+	self.mutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	sig, err := signer.SignHash(hash)
+	if err != nil {
+		// Nothing was signed, so it is safe to try again later:
+		self.mutex.Lock()
+		delete(self.seqno2vote, seqno)
+		self.mutex.Unlock()
+		return
+	}
+
+	votePtr := &BlockBase{Sig: sig, Hash: hash, Seqno: seqno}
+
+	self.mutex.Lock()
+	res := self.block_stat_queue.try_append_to_BlockStatQueue(votePtr)
+	if res == 0 {
+		// Only a vote kept in BlockStat is cast, e.g. not one over
+		// Cfg_consensus_max_candidate_messages:
+		self.metrics.Votes_cast += 1
+		self.on_appended(votePtr, self.clock())
+	}
+	self.mutex.Unlock()
+
+	if res == 0 {
+		self.forward_block(votePtr)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// POLICY: We vote for the hash that currently has the most support for
+// 'seqno'. The choice is recorded before signing, so that concurrent
+// arrivals cannot make us sign two hashes for the same seqno.
+// Caller must hold self.mutex.
+func (self *ConsensusParticipant) choose_vote(
+	seqno uint64) (cipher.SHA256, bool) {
+
+	if !Cfg_consensus_cast_votes || self.signer == nil {
+		return cipher.SHA256{}, false
+	}
+	if _, have := self.seqno2vote[seqno]; have {
+		return cipher.SHA256{}, false
+	}
+	if seqno <= self.max_frozen_seqno {
+		return cipher.SHA256{}, false
+	}
+
+	statPtr := self.block_stat_queue.find_BlockStat(seqno)
+	if statPtr == nil || statPtr.frozen {
+		return cipher.SHA256{}, false
+	}
+
+	hash, _, _ := statPtr.GetBestHashPubkeySig()
+	self.seqno2vote[seqno] = hash
+
+	return hash, true
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Returns the hash we voted for at 'seqno', if we did and it is not
+// yet frozen.
+func (self *ConsensusParticipant) GetVote(seqno uint64) (cipher.SHA256, bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	hash, have := self.seqno2vote[seqno]
+	return hash, have
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Bookkeeping after 'blockPtr' was added to BlockStatQueue.
+// Caller must hold self.mutex.
+func (self *ConsensusParticipant) on_appended(blockPtr *BlockBase, now time.Time) {
+	if statPtr := self.block_stat_queue.find_BlockStat(blockPtr.Seqno); statPtr != nil &&
+		statPtr.first_seen.IsZero() {
+
+		statPtr.first_seen = now
+	}
+	self.seen_cache.Add(blockPtr.Hash, blockPtr.Sig)
+	self.harvest_ripe_BlockStat()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Caller must not hold self.mutex.
+func (self *ConsensusParticipant) forward_block(blockPtr *BlockBase) {
+
+	fanout := Cfg_gossip_fanout
+	pSender, ok := self.pConnectionManager.(SubscriberSenderInterface)
+
+	if fanout <= 0 || !ok {
 		self.pConnectionManager.SendBlockToAllMySubscriber(blockPtr)
+
+		self.mutex.Lock()
+		self.metrics.Headers_forwarded += 1
+		self.mutex.Unlock()
+		return
+	}
+
+	// A copy, as it gets shuffled below:
+	keys := append([]ConnectionKey(nil), pSender.GetSubscriberKeys()...)
+
+	self.mutex.Lock()
+	if len(keys) > fanout {
+		// Partial Fisher-Yates: the first 'fanout' keys are a random pick.
+		for i := 0; i < fanout; i++ {
+			j := i + self.rand.Intn(len(keys)-i)
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+		keys = keys[:fanout]
+	}
+	self.metrics.Headers_forwarded += 1
+	self.metrics.Pushes += uint64(len(keys))
+	self.mutex.Unlock()
+
+	for _, key := range keys {
+		pSender.SendBlockToSubscriber(key, blockPtr)
 	}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
+// Caller must hold self.mutex.
+func (self *ConsensusParticipant) observe_commit(statPtr *BlockStat, top_seqno uint64) {
+	self.metrics.Blocks_committed += 1
+	self.metrics.Commit_latency_seqnos_sum += top_seqno - statPtr.seqno
+
+	if !statPtr.first_seen.IsZero() {
+		latency := self.clock().Sub(statPtr.first_seen).Seconds()
+		self.metrics.Commit_latency_seconds_sum += latency
+		if latency > self.metrics.Commit_latency_seconds_max {
+			self.metrics.Commit_latency_seconds_max = latency
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Caller must hold self.mutex.
+func (self *ConsensusParticipant) freeze_BlockStat(statPtr *BlockStat) {
+	statPtr.frozen = true
+	// A frozen BlockStat takes no more votes, so ours need not be
+	// remembered:
+	delete(self.seqno2vote, statPtr.seqno)
+	if statPtr.seqno > self.max_frozen_seqno {
+		self.max_frozen_seqno = statPtr.seqno
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Caller must hold self.mutex.
 func (self *ConsensusParticipant) harvest_ripe_BlockStat() {
 
 	// POLICY: The BlockStat entries that have much smaller seqno
@@ -156,9 +510,10 @@ func (self *ConsensusParticipant) harvest_ripe_BlockStat() {
 				}
 				res := self.block_queue.try_append_to_BlockchainTail(blockPtr)
 				if res == 0 {
-					// TODO: 'frozen' items should be removed and the 'best'
-					// moved to BlockchainTail.
-					statPtr.frozen = true
+					self.block_queue.set_sigs(hash, statPtr.get_sigs_of(hash))
+					self.block_queue.set_support(hash, statPtr.get_support_of(hash))
+					self.freeze_BlockStat(statPtr)
+					self.observe_commit(statPtr, top_seqno)
 				} else {
 					// Appending did not work. Need to examine 'res'
 					// and log the reason why.
@@ -175,6 +530,14 @@ func (self *ConsensusParticipant) harvest_ripe_BlockStat() {
 		}
 	}
 
+	// POLICY: Keep the frozen BlockStat entries a reorganization can still
+	// unfreeze, i.e. those within Cfg_blockchain_max_reorg_depth of the
+	// tail, and drop the older ones so that the queue stays bounded.
+	next := self.block_queue.GetNextSeqNo()
+	if next > Cfg_blockchain_max_reorg_depth {
+		self.block_stat_queue.drop_frozen_before(
+			next - Cfg_blockchain_max_reorg_depth)
+	}
 }
 
 ////////////////////////////////////////////////////////////////////////////////
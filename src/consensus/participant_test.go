@@ -0,0 +1,346 @@
+//nolint
+package consensus
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/cipher/secp256k1-go"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// Connection managers used by the tests below.
+//
+////////////////////////////////////////////////////////////////////////////////
+type discardConnectionManager struct {
+	mutex sync.Mutex
+	sent  int
+}
+
+func (self *discardConnectionManager) Print() {}
+
+func (self *discardConnectionManager) SendBlockToAllMySubscriber(
+	blockPtr *BlockBase) {
+
+	self.mutex.Lock()
+	self.sent += 1
+	self.mutex.Unlock()
+}
+
+// Delivers synchronously into the subscribers, in the same goroutine.
+type directConnectionManager struct {
+	subscribers []*ConsensusParticipant
+}
+
+func (self *directConnectionManager) Print() {}
+
+func (self *directConnectionManager) SendBlockToAllMySubscriber(
+	blockPtr *BlockBase) {
+
+	for _, p := range self.subscribers {
+		p.OnBlockHeaderArrived(blockPtr)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Every signer signs the same hash for each seqno; the signers deliver
+// their headers in parallel.
+func make_signed_headers(n_signers int, n_seqno int) ([]cipher.SHA256, [][]*BlockBase) {
+	hashes := make([]cipher.SHA256, n_seqno+1)
+	for seqno := 1; seqno <= n_seqno; seqno++ {
+		hashes[seqno] = cipher.SumSHA256(secp256k1.RandByte(888))
+	}
+
+	headers := make([][]*BlockBase, n_signers)
+	for i := 0; i < n_signers; i++ {
+		_, seckey := cipher.GenerateKeyPair()
+		for seqno := 1; seqno <= n_seqno; seqno++ {
+			h := hashes[seqno]
+			headers[i] = append(headers[i], &BlockBase{
+				Sig:   cipher.MustSignHash(h, seckey),
+				Hash:  h,
+				Seqno: uint64(seqno),
+			})
+		}
+	}
+	return hashes, headers
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func check_tail(t *testing.T, p *ConsensusParticipant, hashes []cipher.SHA256) {
+	n_seqno := len(hashes) - 1
+	n_expected := n_seqno - int(Cfg_consensus_waiting_time_as_seqno_diff)
+
+	if p.GetNextBlockSeqNo() != uint64(n_expected+1) {
+		t.Log("ConsensusParticipant::GetNextBlockSeqNo() is", p.GetNextBlockSeqNo(),
+			"expected", n_expected+1)
+		t.Fail()
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for i, b := range p.block_queue.blockPtr_slice {
+		if b.Seqno != uint64(i+1) || b.Hash != hashes[i+1] {
+			t.Log("BlockchainTail has unexpected block at", i, b.String())
+			t.Fail()
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_ParallelArrival(t *testing.T) {
+	n_signers := 6
+	n_seqno := 20
+
+	hashes, headers := make_signed_headers(n_signers, n_seqno)
+
+	pMan := &discardConnectionManager{}
+	p := NewConsensusParticipantPtr(pMan, NewRandomMemorySigner())
+
+	var wg sync.WaitGroup
+	for i := 0; i < n_signers; i++ {
+		wg.Add(1)
+		go func(list []*BlockBase) {
+			defer wg.Done()
+			for _, b := range list {
+				p.OnBlockHeaderArrived(b)
+				p.OnBlockHeaderArrived(b) // Duplicate delivery
+				p.GetNextBlockSeqNo()
+				p.Get_block_stat_queue_Len()
+			}
+		}(headers[i])
+	}
+	wg.Wait()
+
+	if p.Get_Incoming_block_count() != 2*n_signers*n_seqno {
+		t.Log("ConsensusParticipant::OnBlockHeaderArrived() lost updates:",
+			p.Get_Incoming_block_count())
+		t.Fail()
+	}
+	// Late votes for already frozen seqnos are not forwarded, so only
+	// the bounds are known. The participant adds one vote per seqno.
+	if pMan.sent < n_seqno || pMan.sent > (n_signers+1)*n_seqno {
+		t.Log("ConsensusParticipant::OnBlockHeaderArrived() forwarded",
+			pMan.sent, "headers")
+		t.Fail()
+	}
+	check_tail(t, p, hashes)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_ParallelRing(t *testing.T) {
+	n_nodes := 4
+	n_seqno := 20
+
+	hashes, headers := make_signed_headers(n_nodes, n_seqno)
+
+	// Each participant forwards to the next one; forwarding re-enters
+	// the participants from the goroutine of the original sender.
+	managers := make([]*directConnectionManager, n_nodes)
+	nodes := make([]*ConsensusParticipant, n_nodes)
+	for i := 0; i < n_nodes; i++ {
+		managers[i] = &directConnectionManager{}
+		nodes[i] = NewConsensusParticipantPtr(managers[i], NewRandomMemorySigner())
+	}
+	for i := 0; i < n_nodes; i++ {
+		managers[i].subscribers = []*ConsensusParticipant{nodes[(i+1)%n_nodes]}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < n_nodes; i++ {
+		wg.Add(1)
+		go func(p *ConsensusParticipant, list []*BlockBase) {
+			defer wg.Done()
+			for _, b := range list {
+				p.OnBlockHeaderArrived(b)
+			}
+		}(nodes[i], headers[i])
+	}
+	wg.Wait()
+
+	for _, p := range nodes {
+		check_tail(t, p, hashes)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_WatchOnly(t *testing.T) {
+	n_signers := 3
+	n_seqno := 12
+
+	hashes, headers := make_signed_headers(n_signers, n_seqno)
+
+	pMan := &discardConnectionManager{}
+	p := NewWatchOnlyConsensusParticipantPtr(pMan)
+
+	if !p.IsWatchOnly() || p.Pubkey != (cipher.PubKey{}) {
+		t.Log("NewWatchOnlyConsensusParticipantPtr() has a signing identity.")
+		t.Fail()
+	}
+	if _, err := p.SignatureOf(hashes[1]); err != ErrWatchOnly {
+		t.Log("ConsensusParticipant::SignatureOf() did not refuse to sign:", err)
+		t.Fail()
+	}
+
+	for seqno := 0; seqno < n_seqno; seqno++ {
+		for i := 0; i < n_signers; i++ {
+			p.OnBlockHeaderArrived(headers[i][seqno])
+		}
+	}
+
+	if pMan.sent != n_signers*n_seqno {
+		t.Log("Watch-only participant relayed", pMan.sent, "headers, or voted.")
+		t.Fail()
+	}
+	check_tail(t, p, hashes)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+type countingSigner struct {
+	MemorySigner
+	mutex sync.Mutex
+	count int
+}
+
+func (self *countingSigner) SignHash(hash cipher.SHA256) (cipher.Sig, error) {
+	self.mutex.Lock()
+	self.count += 1
+	self.mutex.Unlock()
+	return self.MemorySigner.SignHash(hash)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Returns the hashes that 'pubkey' signed in the BlockStat for 'seqno'.
+func hashes_signed_by(p *ConsensusParticipant, seqno uint64,
+	pubkey cipher.PubKey) []cipher.SHA256 {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var hashes []cipher.SHA256
+	statPtr := p.block_stat_queue.find_BlockStat(seqno)
+	if statPtr == nil {
+		return nil
+	}
+	for hash, info := range statPtr.hash2info {
+		if _, have := info.pubkey2sig[pubkey]; have {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_Vote(t *testing.T) {
+	pMan := &discardConnectionManager{}
+	p := NewConsensusParticipantPtr(pMan, NewRandomMemorySigner())
+
+	_, headers_a := make_signed_headers(1, 1)
+	_, headers_b := make_signed_headers(3, 1)
+	hash_a := headers_a[0][0].Hash
+
+	p.OnBlockHeaderArrived(headers_a[0][0])
+
+	if vote, have := p.GetVote(1); !have || vote != hash_a {
+		t.Log("ConsensusParticipant did not vote for the only candidate.")
+		t.Fail()
+	}
+	if signed := hashes_signed_by(p, 1, p.Pubkey); len(signed) != 1 ||
+		signed[0] != hash_a {
+		t.Log("ConsensusParticipant's vote is not in its own BlockStat.")
+		t.Fail()
+	}
+	if pMan.sent != 2 {
+		t.Log("ConsensusParticipant did not gossip its vote:", pMan.sent)
+		t.Fail()
+	}
+
+	// More support for another hash must not make us sign it too:
+	for i := 0; i < 3; i++ {
+		p.OnBlockHeaderArrived(headers_b[i][0])
+	}
+	if signed := hashes_signed_by(p, 1, p.Pubkey); len(signed) != 1 ||
+		signed[0] != hash_a {
+		t.Log("ConsensusParticipant signed two hashes for the same seqno.")
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_VoteOnceParallel(t *testing.T) {
+	n_candidates := 8
+
+	signer := &countingSigner{MemorySigner: *NewRandomMemorySigner()}
+	p := NewConsensusParticipantPtr(&discardConnectionManager{}, signer)
+
+	// Competing hashes for the same seqno, arriving in parallel:
+	var list []*BlockBase
+	for i := 0; i < n_candidates; i++ {
+		_, headers := make_signed_headers(1, 1)
+		list = append(list, headers[0][0])
+	}
+
+	var wg sync.WaitGroup
+	for _, b := range list {
+		wg.Add(1)
+		go func(b *BlockBase) {
+			defer wg.Done()
+			p.OnBlockHeaderArrived(b)
+		}(b)
+	}
+	wg.Wait()
+
+	if signer.count != 1 {
+		t.Log("ConsensusParticipant signed", signer.count, "votes for one seqno.")
+		t.Fail()
+	}
+	if len(hashes_signed_by(p, 1, p.Pubkey)) != 1 {
+		t.Log("ConsensusParticipant's vote is missing from its own BlockStat.")
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_BlockStatQueueBounded(t *testing.T) {
+	n_seqno := 300
+
+	hashes := make([]cipher.SHA256, n_seqno+1)
+	n_signers := make([]int, n_seqno+1)
+	for seqno := 1; seqno <= n_seqno; seqno++ {
+		hashes[seqno] = cipher.SumSHA256(secp256k1.RandByte(888))
+		n_signers[seqno] = 2
+	}
+	p := NewConsensusParticipantPtr(&discardConnectionManager{}, nil)
+	feed_headers(p, hashes, n_signers)
+
+	// Frozen entries are kept only as deep as a reorganization can reach,
+	// the rest are still waiting to ripen:
+	max_len := int(Cfg_blockchain_max_reorg_depth +
+		Cfg_consensus_waiting_time_as_seqno_diff + 1)
+	if n := p.Get_block_stat_queue_Len(); n > max_len {
+		t.Log("BlockStatQueue has", n, "entries, expected at most", max_len)
+		t.Fail()
+	}
+	want := uint64(n_seqno) - Cfg_consensus_waiting_time_as_seqno_diff + 1
+	if p.GetNextBlockSeqNo() != want {
+		t.Log("ConsensusParticipant::GetNextBlockSeqNo() is",
+			p.GetNextBlockSeqNo(), "expected", want)
+		t.Fail()
+	}
+
+	// Votes for dropped seqnos are rejected as too old:
+	_, seckey := cipher.GenerateKeyPair()
+	p.OnBlockHeaderArrived(&BlockBase{
+		Sig:   cipher.MustSignHash(hashes[1], seckey),
+		Hash:  hashes[1],
+		Seqno: 1,
+	})
+	if n := p.Get_block_stat_queue_Len(); n > max_len {
+		t.Log("BlockStatQueue grew to", n, "entries on a stale vote")
+		t.Fail()
+	}
+}
@@ -0,0 +1,477 @@
+//nolint
+package consensus
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// Property tests over random arrival orders. Each test logs its seed, so
+// that a failure can be replayed.
+//
+////////////////////////////////////////////////////////////////////////////////
+const property_seed int64 = 20161025
+const property_runs int = 20
+
+////////////////////////////////////////////////////////////////////////////////
+// 'n_signers' signers each sign one of 'n_hashes' hashes, for one seqno.
+func make_votes(r *rand.Rand, n_signers int, n_hashes int) []BlockBase {
+	hashes := make([]cipher.SHA256, n_hashes)
+	for i := range hashes {
+		hashes[i] = cipher.SumSHA256([]byte{byte(i), byte(r.Int())})
+	}
+
+	votes := make([]BlockBase, 0, n_signers)
+	for i := 0; i < n_signers; i++ {
+		_, seckey := cipher.GenerateKeyPair()
+		h := hashes[r.Intn(n_hashes)]
+		votes = append(votes, BlockBase{Sig: cipher.MustSignHash(h, seckey), Hash: h, Seqno: 1})
+	}
+	return votes
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func tally_of(stat *BlockStat) map[cipher.SHA256]int {
+	tally := make(map[cipher.SHA256]int)
+	for hash, info := range stat.hash2info {
+		tally[hash] = len(info.pubkey2sig)
+	}
+	return tally
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func FuzzBlockStat_try_add_hash_and_sig(f *testing.F) {
+	_, seckey := cipher.GenerateKeyPair()
+	hash := cipher.SumSHA256([]byte("seed"))
+	sig := cipher.MustSignHash(hash, seckey)
+	f.Add(hash[:], sig[:], false)
+	f.Add(hash[:], sig[:], true)
+	f.Add(make([]byte, len(hash)), sig[:], false)
+	f.Add([]byte{}, []byte{}, false)
+
+	f.Fuzz(func(t *testing.T, hash_bytes []byte, sig_bytes []byte, frozen bool) {
+		var hash cipher.SHA256
+		var sig cipher.Sig
+		copy(hash[:], hash_bytes)
+		copy(sig[:], sig_bytes)
+
+		stat := BlockStat{}
+		stat.Init()
+		stat.frozen = frozen
+
+		res := stat.try_add_hash_and_sig(hash, sig)
+		switch {
+		case frozen:
+			if res != 3 || len(stat.hash2info) != 0 {
+				t.Fatal("Frozen BlockStat returned", res)
+			}
+		case res == 4:
+			if stat.accept_count != 0 || len(stat.hash2info) != 0 {
+				t.Fatal("Rejected signature was recorded")
+			}
+		case res == 0:
+			best_hash, best_pubkey, best_sig := stat.GetBestHashPubkeySig()
+			if best_hash != hash || best_sig != sig || stat.accept_count != 1 {
+				t.Fatal("Accepted signature is not the best")
+			}
+			if pubkey, err := cipher.PubKeyFromSig(sig, hash); err != nil || pubkey != best_pubkey {
+				t.Fatal("Accepted signature has the wrong signer")
+			}
+			if again := stat.try_add_hash_and_sig(hash, sig); again != 1 {
+				t.Fatal("Duplicate returned", again)
+			}
+		default:
+			t.Fatal("Fresh BlockStat returned", res)
+		}
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestBlockStat_OrderIndependentTally(t *testing.T) {
+	t.Log("Seed", property_seed)
+	r := rand.New(rand.NewSource(property_seed))
+
+	for run := 0; run < property_runs; run++ {
+		votes := make_votes(r, Cfg_consensus_max_candidate_messages-1, 1+r.Intn(4))
+		// Duplicates and invalid signatures must not change the tally either:
+		votes = append(votes, votes[0], BlockBase{Hash: votes[0].Hash, Seqno: 1})
+
+		var expected map[cipher.SHA256]int
+		for perm := 0; perm < 5; perm++ {
+			stat := BlockStat{}
+			stat.Init()
+			for _, i := range r.Perm(len(votes)) {
+				stat.try_add_hash_and_sig(votes[i].Hash, votes[i].Sig)
+			}
+
+			tally := tally_of(&stat)
+			if expected == nil {
+				expected = tally
+				continue
+			}
+			if len(tally) != len(expected) {
+				t.Fatal("Run", run, "permutation", perm, "has", len(tally),
+					"hashes, expected", len(expected))
+			}
+			for hash, n := range expected {
+				if tally[hash] != n {
+					t.Fatal("Run", run, "permutation", perm, "tallied",
+						tally[hash], "for a hash, expected", n)
+				}
+			}
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestBlockStat_BestHashMonotonic(t *testing.T) {
+	t.Log("Seed", property_seed)
+	r := rand.New(rand.NewSource(property_seed))
+
+	for run := 0; run < property_runs; run++ {
+		votes := make_votes(r, Cfg_consensus_max_candidate_messages, 1+r.Intn(3))
+
+		stat := BlockStat{}
+		stat.Init()
+		best_count := 0
+		var best_hash cipher.SHA256
+
+		for _, i := range r.Perm(len(votes)) {
+			if stat.try_add_hash_and_sig(votes[i].Hash, votes[i].Sig) != 0 {
+				t.Fatal("Run", run, "rejected a valid vote")
+			}
+			hash, _, _ := stat.GetBestHashPubkeySig()
+			tally := tally_of(&stat)
+
+			for _, n := range tally {
+				if n > tally[hash] {
+					t.Fatal("Run", run, "best hash is not the most signed")
+				}
+			}
+			if tally[hash] < best_count {
+				t.Fatal("Run", run, "best count went down from", best_count)
+			}
+			// A vote for the best hash keeps it the best:
+			if votes[i].Hash == best_hash && hash != best_hash {
+				t.Fatal("Run", run, "best hash changed on a vote for it")
+			}
+			best_count, best_hash = tally[hash], hash
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestBlockchainTail_Contiguity(t *testing.T) {
+	t.Log("Seed", property_seed)
+	r := rand.New(rand.NewSource(property_seed))
+
+	for run := 0; run < property_runs; run++ {
+		bq := BlockchainTail{}
+		bq.Init()
+
+		for i := 0; i < 3*Cfg_blockchain_tail_length; i++ {
+			next := bq.GetNextSeqNo()
+			// Mostly near the next seqno, sometimes a repeat hash:
+			seqno := next + uint64(r.Intn(3))
+			if next > 1 {
+				seqno -= uint64(r.Intn(2))
+			}
+			hash := cipher.SumSHA256([]byte{byte(run), byte(r.Intn(64))})
+			b := BlockBase{Hash: hash, Seqno: seqno}
+
+			res := bq.try_append_to_BlockchainTail(&b)
+			n := len(bq.blockPtr_slice)
+			if (res == 0) != (n > 0 && bq.blockPtr_slice[n-1] == &b) {
+				t.Fatal("Run", run, "try_append_to_BlockchainTail() returned", res)
+			}
+			if !bq.is_consistent() {
+				t.Fatal("Run", run, "BlockchainTail is not consistent after", i, "appends")
+			}
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_RandomArrivalOrder(t *testing.T) {
+	t.Log("Seed", property_seed)
+	r := rand.New(rand.NewSource(property_seed))
+
+	n_signers := 3
+	n_seqno := 12
+	hashes, headers := make_signed_headers(n_signers, n_seqno)
+
+	for run := 0; run < 5; run++ {
+		p := NewWatchOnlyConsensusParticipantPtr(&discardConnectionManager{})
+		// A random interleaving of what each signer sends in order, as
+		// over one connection per signer:
+		next := make([]int, n_signers)
+		for left := n_signers * n_seqno; left > 0; left-- {
+			i := r.Intn(n_signers)
+			for next[i] == n_seqno {
+				i = (i + 1) % n_signers
+			}
+			p.OnBlockHeaderArrived(headers[i][next[i]])
+			next[i]++
+		}
+
+		check_tail(t, p, hashes)
+		p.mutex.Lock()
+		if !p.block_queue.is_consistent() {
+			t.Log("Run", run, "BlockchainTail is not consistent")
+			t.Fail()
+		}
+		p.mutex.Unlock()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Calls 'f' with every permutation of 0..n-1 (Heap's algorithm).
+func for_each_permutation(n int, f func(perm []int)) {
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+	c := make([]int, n)
+	f(perm)
+	for i := 0; i < n; {
+		if c[i] < i {
+			if i%2 == 0 {
+				perm[0], perm[i] = perm[i], perm[0]
+			} else {
+				perm[c[i]], perm[i] = perm[i], perm[c[i]]
+			}
+			f(perm)
+			c[i]++
+			i = 0
+		} else {
+			c[i] = 0
+			i++
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Two hashes with two signers each, and one with a single signer: the
+// smaller of the two tied hashes must win.
+func make_tied_votes() ([]BlockBase, cipher.SHA256) {
+	a := cipher.SumSHA256([]byte("a"))
+	b := cipher.SumSHA256([]byte("b"))
+	c := cipher.SumSHA256([]byte("c"))
+
+	var votes []BlockBase
+	for _, h := range []cipher.SHA256{a, a, b, b, c} {
+		_, seckey := cipher.GenerateKeyPair()
+		votes = append(votes, BlockBase{Sig: cipher.MustSignHash(h, seckey), Hash: h, Seqno: 1})
+	}
+
+	if bytes.Compare(a[:], b[:]) < 0 {
+		return votes, a
+	}
+	return votes, b
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestBlockStat_TieBreak(t *testing.T) {
+	votes, smaller := make_tied_votes()
+	a, b := votes[0].Hash, votes[2].Hash
+
+	stat := BlockStat{}
+	stat.Init()
+	for _, v := range votes {
+		stat.try_add_hash_and_sig(v.Hash, v.Sig)
+	}
+	if hash, _, _ := stat.GetBestHashPubkeySig(); hash != smaller {
+		t.Log("BlockStat::GetBestHashPubkeySig() did not pick the smaller tied hash.")
+		t.Fail()
+	}
+
+	// Weight decides before the hash does:
+	heavy, _ := cipher.PubKeyFromSig(votes[2].Sig, b)
+	if smaller == b {
+		heavy, _ = cipher.PubKeyFromSig(votes[0].Sig, a)
+	}
+	Cfg_consensus_signer_weight = func(pubkey cipher.PubKey) uint64 {
+		if pubkey == heavy {
+			return 10
+		}
+		return 1
+	}
+	defer func() { Cfg_consensus_signer_weight = nil }()
+
+	if hash, _, _ := stat.GetBestHashPubkeySig(); hash == smaller {
+		t.Log("BlockStat::GetBestHashPubkeySig() ignored signer weights.")
+		t.Fail()
+	}
+
+	// But the number of signers decides before the weight does:
+	_, seckey := cipher.GenerateKeyPair()
+	stat.try_add_hash_and_sig(smaller, cipher.MustSignHash(smaller, seckey))
+	if hash, _, _ := stat.GetBestHashPubkeySig(); hash != smaller {
+		t.Log("BlockStat::GetBestHashPubkeySig() preferred weight to signer count.")
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestBlockStat_AllPermutationsSameBest(t *testing.T) {
+	votes, smaller := make_tied_votes()
+
+	var first *BlockBase
+	n := 0
+	for_each_permutation(len(votes), func(perm []int) {
+		stat := BlockStat{}
+		stat.Init()
+		for _, i := range perm {
+			stat.try_add_hash_and_sig(votes[i].Hash, votes[i].Sig)
+		}
+		hash, _, sig := stat.GetBestHashPubkeySig()
+		best := &BlockBase{Sig: sig, Hash: hash, Seqno: 1}
+
+		if first == nil {
+			first = best
+		} else if *best != *first {
+			t.Fatal("Permutation", perm, "gave", best.String(), "not", first.String())
+		}
+		n++
+	})
+
+	if first.Hash != smaller || n != 120 {
+		t.Log("Best hash of", n, "permutations is not the smaller tied hash.")
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_AllPermutationsSameCommit(t *testing.T) {
+	votes, smaller := make_tied_votes()
+
+	// Later seqnos, to ripen seqno 1:
+	_, seckey := cipher.GenerateKeyPair()
+	var later []*BlockBase
+	for seqno := uint64(2); seqno <= 1+Cfg_consensus_waiting_time_as_seqno_diff; seqno++ {
+		h := cipher.SumSHA256([]byte{byte(seqno)})
+		later = append(later, &BlockBase{Sig: cipher.MustSignHash(h, seckey), Hash: h, Seqno: seqno})
+	}
+
+	var first *BlockBase
+	for_each_permutation(len(votes), func(perm []int) {
+		p := NewWatchOnlyConsensusParticipantPtr(&discardConnectionManager{})
+		for _, i := range perm {
+			b := votes[i]
+			p.OnBlockHeaderArrived(&b)
+		}
+		for _, b := range later {
+			p.OnBlockHeaderArrived(b)
+		}
+
+		p.mutex.Lock()
+		committed := p.block_queue.get_block_at(1)
+		sigs := p.block_queue.get_sigs(smaller)
+		p.mutex.Unlock()
+
+		if committed == nil {
+			t.Fatal("Permutation", perm, "committed nothing")
+		}
+		if first == nil {
+			first = committed
+		} else if *committed != *first {
+			t.Fatal("Permutation", perm, "committed", committed.String(),
+				"not", first.String())
+		}
+		if len(sigs) != 2 {
+			t.Fatal("Permutation", perm, "certified", len(sigs), "signers")
+		}
+	})
+
+	if first.Hash != smaller {
+		t.Log("Committed hash is not the smaller tied hash.")
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Above Cfg_consensus_max_candidate_messages, the best hash and the
+// support of each hash still do not depend on arrival order.
+func TestBlockStat_OrderIndependentAboveLimit(t *testing.T) {
+	t.Log("Seed", property_seed)
+	r := rand.New(rand.NewSource(property_seed))
+
+	for run := 0; run < property_runs; run++ {
+		votes := make_votes(r, 3*Cfg_consensus_max_candidate_messages, 1+r.Intn(3))
+
+		expected := make(map[cipher.SHA256]int)
+		for _, v := range votes {
+			expected[v.Hash] += 1
+		}
+
+		var first_hash cipher.SHA256
+		for perm := 0; perm < 5; perm++ {
+			stat := BlockStat{}
+			stat.Init()
+			for _, i := range r.Perm(len(votes)) {
+				stat.try_add_hash_and_sig(votes[i].Hash, votes[i].Sig)
+			}
+
+			for hash, n := range expected {
+				if support := stat.get_support_of(hash); support != n {
+					t.Fatal("Run", run, "permutation", perm, "has support", support,
+						"for a hash with", n, "signers")
+				}
+			}
+			hash, _, _ := stat.GetBestHashPubkeySig()
+			if perm == 0 {
+				first_hash = hash
+			} else if hash != first_hash {
+				t.Fatal("Run", run, "permutation", perm, "changed the best hash")
+			}
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// A hash first seen after Cfg_consensus_max_candidate_messages is still a
+// candidate, and wins if more sign it, with a signature that verifies.
+func TestBlockStat_HashAfterLimitCandidate(t *testing.T) {
+	a := cipher.SumSHA256([]byte("a"))
+	b := cipher.SumSHA256([]byte("b"))
+
+	sign := func(hash cipher.SHA256, n int) []BlockBase {
+		var votes []BlockBase
+		for i := 0; i < n; i++ {
+			_, seckey := cipher.GenerateKeyPair()
+			votes = append(votes, BlockBase{Sig: cipher.MustSignHash(hash, seckey), Hash: hash, Seqno: 1})
+		}
+		return votes
+	}
+	votes_a := sign(a, Cfg_consensus_max_candidate_messages)
+	votes_b := sign(b, Cfg_consensus_max_candidate_messages+1)
+
+	check := func(votes []BlockBase) {
+		stat := BlockStat{}
+		stat.Init()
+		for _, v := range votes {
+			stat.try_add_hash_and_sig(v.Hash, v.Sig)
+		}
+		hash, pubkey, sig := stat.GetBestHashPubkeySig()
+		if hash != b {
+			t.Log("The hash with more signers is not the best.")
+			t.Fail()
+		}
+		if cipher.VerifyPubKeySignedHash(pubkey, sig, hash) != nil {
+			t.Log("The best hash has no valid signature.")
+			t.Fail()
+		}
+		if support := stat.get_support_of(b); support != len(votes_b) {
+			t.Log("The best hash has support", support, "expected", len(votes_b))
+			t.Fail()
+		}
+	}
+
+	check(append(append([]BlockBase(nil), votes_a...), votes_b...))
+	check(append(append([]BlockBase(nil), votes_b...), votes_a...))
+}
@@ -0,0 +1,145 @@
+//nolint
+package consensus
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// Block proposal. A proposer builds and signs a BlockBase for the next
+// seqno; the others then vote on it as on any other candidate.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+var ErrNotProposer = errors.New("consensus: not the proposer for this seqno")
+var ErrAlreadyProposed = errors.New("consensus: already signed a hash for this seqno")
+
+////////////////////////////////////////////////////////////////////////////////
+// ProposerSchedule decides who may propose a block for a given seqno.
+type ProposerSchedule interface {
+	IsProposer(pubkey cipher.PubKey, seqno uint64) bool
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// AnyProposer lets every participant propose.
+type AnyProposer struct{}
+
+func (self AnyProposer) IsProposer(pubkey cipher.PubKey, seqno uint64) bool {
+	return true
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// RoundRobinProposer rotates over a known set: seqno N goes to
+// Pubkeys[N % len(Pubkeys)].
+type RoundRobinProposer struct {
+	Pubkeys []cipher.PubKey
+}
+
+func (self RoundRobinProposer) IsProposer(pubkey cipher.PubKey, seqno uint64) bool {
+	n := uint64(len(self.Pubkeys))
+	if n == 0 {
+		return false
+	}
+	return self.Pubkeys[seqno%n] == pubkey
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// LeaderProposer lets only the designated leader propose.
+type LeaderProposer struct {
+	Leader cipher.PubKey
+}
+
+func (self LeaderProposer) IsProposer(pubkey cipher.PubKey, seqno uint64) bool {
+	return self.Leader == pubkey
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *ConsensusParticipant) SetProposerSchedule(schedule ProposerSchedule) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.proposer_schedule = schedule
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// The seqno a proposal would get now: one past everything we have seen,
+// whether already in BlockchainTail or still a candidate.
+// Caller must hold self.mutex.
+func (self *ConsensusParticipant) get_next_proposal_seqno() uint64 {
+	seqno := self.block_queue.GetNextSeqNo()
+
+	n := len(self.block_stat_queue.queue)
+	if n > 0 && self.block_stat_queue.queue[n-1].seqno >= seqno {
+		seqno = self.block_stat_queue.queue[n-1].seqno + 1
+	}
+	return seqno
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *ConsensusParticipant) GetNextProposalSeqNo() uint64 {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return self.get_next_proposal_seqno()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Builds a BlockBase for the next seqno with the hash of 'payload',
+// signs it, adds it to our own candidates and broadcasts it. Our
+// signature on the proposal is also our vote for that seqno.
+func (self *ConsensusParticipant) ProposeBlock(payload []byte) (*BlockBase, error) {
+
+	hash := cipher.SumSHA256(payload)
+
+	self.mutex.Lock()
+	signer := self.signer
+	seqno := self.get_next_proposal_seqno()
+	var err error
+	if signer == nil {
+		err = ErrWatchOnly
+	} else if !self.proposer_schedule.IsProposer(self.Pubkey, seqno) {
+		err = ErrNotProposer
+	} else if _, have := self.seqno2vote[seqno]; have {
+		err = ErrAlreadyProposed // A concurrent ProposeBlock() got here first
+	} else {
+		self.seqno2vote[seqno] = hash
+	}
+	self.mutex.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := signer.SignHash(hash)
+	if err != nil {
+		self.mutex.Lock()
+		delete(self.seqno2vote, seqno)
+		self.mutex.Unlock()
+		return nil, err
+	}
+
+	blockPtr := &BlockBase{Sig: sig, Hash: hash, Seqno: seqno}
+
+	self.mutex.Lock()
+	self.metrics.Blocks_proposed += 1
+	res := self.block_stat_queue.try_append_to_BlockStatQueue(blockPtr)
+	if res == 0 {
+		self.on_appended(blockPtr, self.clock())
+	}
+	self.mutex.Unlock()
+
+	if res != 0 {
+		return nil, fmt.Errorf("consensus: proposal for seqno %d rejected locally, code %d",
+			seqno, res)
+	}
+
+	self.forward_block(blockPtr)
+
+	return blockPtr, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,117 @@
+//nolint
+package consensus
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+func TestProposerSchedule_01(t *testing.T) {
+	a, _ := cipher.GenerateKeyPair()
+	b, _ := cipher.GenerateKeyPair()
+
+	rr := RoundRobinProposer{Pubkeys: []cipher.PubKey{a, b}}
+	if !rr.IsProposer(a, 2) || rr.IsProposer(b, 2) || !rr.IsProposer(b, 3) {
+		t.Log("RoundRobinProposer::IsProposer() wrong rotation.")
+		t.Fail()
+	}
+	if (RoundRobinProposer{}).IsProposer(a, 0) {
+		t.Log("RoundRobinProposer::IsProposer() empty set allowed a proposer.")
+		t.Fail()
+	}
+
+	leader := LeaderProposer{Leader: a}
+	if !leader.IsProposer(a, 7) || leader.IsProposer(b, 7) {
+		t.Log("LeaderProposer::IsProposer() failed.")
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_ProposeBlock(t *testing.T) {
+	pMan := &discardConnectionManager{}
+	p := NewConsensusParticipantPtr(pMan, NewRandomMemorySigner())
+
+	b1, err := p.ProposeBlock([]byte("payload 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b1.Seqno != 1 || b1.Hash != cipher.SumSHA256([]byte("payload 1")) ||
+		cipher.VerifyPubKeySignedHash(p.Pubkey, b1.Sig, b1.Hash) != nil {
+		t.Log("ConsensusParticipant::ProposeBlock() built a bad block:", b1.String())
+		t.Fail()
+	}
+	if pMan.sent != 1 || p.Get_block_stat_queue_Len() != 1 {
+		t.Log("ConsensusParticipant::ProposeBlock() did not inject and broadcast.")
+		t.Fail()
+	}
+
+	b2, err := p.ProposeBlock([]byte("payload 2"))
+	if err != nil || b2.Seqno != 2 {
+		t.Log("ConsensusParticipant::ProposeBlock() did not advance the seqno:", err)
+		t.Fail()
+	}
+
+	other, _ := cipher.GenerateKeyPair()
+	p.SetProposerSchedule(LeaderProposer{Leader: other})
+	if _, err := p.ProposeBlock([]byte("payload 3")); err != ErrNotProposer {
+		t.Log("ConsensusParticipant::ProposeBlock() ignored the schedule:", err)
+		t.Fail()
+	}
+
+	w := NewWatchOnlyConsensusParticipantPtr(pMan)
+	if _, err := w.ProposeBlock([]byte("payload 1")); err != ErrWatchOnly {
+		t.Log("ConsensusParticipant::ProposeBlock() watch-only proposed:", err)
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_RoundRobinNetwork(t *testing.T) {
+	n_nodes := 4
+	n_seqno := 15
+
+	net := new_complete_testNetwork(n_nodes, 1)
+
+	schedule := RoundRobinProposer{}
+	for _, p := range net.nodes {
+		schedule.Pubkeys = append(schedule.Pubkeys, p.Pubkey)
+	}
+	for _, p := range net.nodes {
+		p.SetProposerSchedule(schedule)
+	}
+
+	hashes := make([]cipher.SHA256, n_seqno+1)
+	for seqno := 1; seqno <= n_seqno; seqno++ {
+		payload := []byte(fmt.Sprintf("block %d", seqno))
+		hashes[seqno] = cipher.SumSHA256(payload)
+
+		proposed := 0
+		for _, p := range net.nodes {
+			b, err := p.ProposeBlock(payload)
+			if err == ErrNotProposer {
+				continue
+			}
+			if err != nil || b.Seqno != uint64(seqno) {
+				t.Fatal("ConsensusParticipant::ProposeBlock() failed:", err)
+			}
+			proposed += 1
+		}
+		if proposed != 1 {
+			t.Fatal("Round-robin let", proposed, "nodes propose seqno", seqno)
+		}
+		net.run()
+	}
+
+	for _, p := range net.nodes {
+		check_tail(t, p, hashes)
+		// Everybody voted for every proposal:
+		if signed := hashes_signed_by(p, uint64(n_seqno), p.Pubkey); len(signed) != 1 {
+			t.Log("Node did not vote on the proposal.")
+			t.Fail()
+		}
+	}
+}
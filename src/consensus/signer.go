@@ -0,0 +1,207 @@
+//nolint
+package consensus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/cipher/encrypt"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// Signer is what ConsensusParticipant uses for signing, so that it never
+// holds a SecKey itself.
+//
+////////////////////////////////////////////////////////////////////////////////
+type Signer interface {
+	GetPubkey() cipher.PubKey
+	SignHash(hash cipher.SHA256) (cipher.Sig, error)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// MemorySigner keeps the key pair in memory. Meant for tests and
+// simulations, and as what FileKeystore.Unlock() returns.
+//
+////////////////////////////////////////////////////////////////////////////////
+type MemorySigner struct {
+	pubkey cipher.PubKey
+	seckey cipher.SecKey
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func NewMemorySigner(seckey cipher.SecKey) (*MemorySigner, error) {
+	pubkey, err := cipher.PubKeyFromSecKey(seckey)
+	if err != nil {
+		return nil, err
+	}
+	return &MemorySigner{pubkey: pubkey, seckey: seckey}, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func NewRandomMemorySigner() *MemorySigner {
+	pubkey, seckey := cipher.GenerateKeyPair()
+	return &MemorySigner{pubkey: pubkey, seckey: seckey}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *MemorySigner) GetPubkey() cipher.PubKey {
+	return self.pubkey
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *MemorySigner) SignHash(hash cipher.SHA256) (cipher.Sig, error) {
+	// PERFORMANCE: This is expensive when cipher.DebugLevel2 or
+	// cipher.DebugLevel1 are true:
+	return cipher.SignHash(hash, self.seckey)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// FileKeystore keeps one secret key in a file, encrypted with a
+// passphrase (scrypt key derivation, chacha20poly1305 encryption).
+//
+////////////////////////////////////////////////////////////////////////////////
+
+// Tests may use cheaper scrypt parameters. The parameters are stored
+// with the encrypted data, so changing them does not affect existing files.
+var Cfg_keystore_encryptor = encrypt.DefaultScryptChacha20poly1305
+
+var ErrKeystoreWrongPassphrase = errors.New("keystore: wrong passphrase or corrupted file")
+
+const keystore_version = 1
+
+type keystore_file struct {
+	Version int    `json:"version"`
+	Pubkey  string `json:"pubkey"`
+	Crypto  string `json:"crypto"`
+	Data    string `json:"data"` // Encrypted SecKey
+}
+
+type FileKeystore struct {
+	path string
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func NewFileKeystore(path string) *FileKeystore {
+	return &FileKeystore{path: path}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Encrypts 'seckey' with 'passphrase' and writes it to the keystore
+// file, which is replaced by one with owner-only permissions.
+func (self *FileKeystore) Save(seckey cipher.SecKey, passphrase []byte) error {
+	pubkey, err := cipher.PubKeyFromSecKey(seckey)
+	if err != nil {
+		return err
+	}
+
+	data, err := Cfg_keystore_encryptor.Encrypt(seckey[:], passphrase)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(keystore_file{
+		Version: keystore_version,
+		Pubkey:  pubkey.Hex(),
+		Crypto:  "scrypt-chacha20poly1305",
+		Data:    string(data),
+	}, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	// WriteFile keeps the permissions of an existing file, so write a new
+	// one, created 0600, and rename it over:
+	tmp, err := ioutil.TempFile(filepath.Dir(self.path), filepath.Base(self.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), self.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Returns the pubkey stored in the keystore file, without decrypting.
+func (self *FileKeystore) GetPubkey() (cipher.PubKey, error) {
+	kf, err := self.read()
+	if err != nil {
+		return cipher.PubKey{}, err
+	}
+	return cipher.PubKeyFromHex(kf.Pubkey)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Decrypts the secret key and returns a Signer holding it.
+func (self *FileKeystore) Unlock(passphrase []byte) (Signer, error) {
+	kf, err := self.read()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(kf.Data) < 4 {
+		return nil, ErrKeystoreWrongPassphrase
+	}
+	// The scrypt parameters come from the encrypted data itself:
+	data, err := encrypt.ScryptChacha20poly1305{}.Decrypt([]byte(kf.Data), passphrase)
+	if err != nil {
+		return nil, ErrKeystoreWrongPassphrase
+	}
+
+	seckey, err := cipher.NewSecKey(data)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := NewMemorySigner(seckey)
+	if err != nil {
+		return nil, err
+	}
+	if signer.GetPubkey().Hex() != kf.Pubkey {
+		return nil, fmt.Errorf("keystore %s: pubkey does not match the secret key", self.path)
+	}
+	return signer, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *FileKeystore) read() (*keystore_file, error) {
+	content, err := ioutil.ReadFile(self.path)
+	if err != nil {
+		return nil, err
+	}
+
+	kf := &keystore_file{}
+	if err := json.Unmarshal(content, kf); err != nil {
+		return nil, fmt.Errorf("keystore %s: %v", self.path, err)
+	}
+	if kf.Version != keystore_version {
+		return nil, fmt.Errorf("keystore %s: unsupported version %d", self.path, kf.Version)
+	}
+	return kf, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Returns true if a keystore file exists at the path.
+func (self *FileKeystore) Exists() bool {
+	_, err := os.Stat(self.path)
+	return err == nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
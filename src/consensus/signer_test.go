@@ -0,0 +1,138 @@
+//nolint
+package consensus
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/cipher/secp256k1-go"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+func TestMemorySigner_01(t *testing.T) {
+	signer := NewRandomMemorySigner()
+	hash := cipher.SumSHA256(secp256k1.RandByte(888))
+
+	sig, err := signer.SignHash(hash)
+	if err != nil {
+		t.Log("MemorySigner::SignHash() failed:", err)
+		t.FailNow()
+	}
+	if cipher.VerifyPubKeySignedHash(signer.GetPubkey(), sig, hash) != nil {
+		t.Log("MemorySigner::SignHash() signature does not verify.")
+		t.Fail()
+	}
+
+	p := NewConsensusParticipantPtr(&discardConnectionManager{}, signer)
+	if p.Pubkey != signer.GetPubkey() {
+		t.Log("ConsensusParticipant::SetSigner() did not set Pubkey.")
+		t.Fail()
+	}
+	sig2, err := p.SignatureOf(hash)
+	if err != nil || cipher.VerifyPubKeySignedHash(p.Pubkey, sig2, hash) != nil {
+		t.Log("ConsensusParticipant::SignatureOf() failed:", err)
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestFileKeystore_01(t *testing.T) {
+	saved := Cfg_keystore_encryptor
+	defer func() { Cfg_keystore_encryptor = saved }()
+	Cfg_keystore_encryptor.N = 1 << 10 // Fast, for testing only
+
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ks := NewFileKeystore(filepath.Join(dir, "key.json"))
+	if ks.Exists() {
+		t.Log("FileKeystore::Exists() true before Save().")
+		t.Fail()
+	}
+
+	pubkey, seckey := cipher.GenerateKeyPair()
+	passphrase := []byte("correct horse battery staple")
+
+	if err := ks.Save(seckey, passphrase); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "key.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{seckey.Hex(), string(seckey[:])} {
+		if len(secret) > 0 && strings.Contains(string(content), secret) {
+			t.Log("FileKeystore::Save() wrote the secret key in the clear.")
+			t.Fail()
+		}
+	}
+
+	stored_pubkey, err := ks.GetPubkey()
+	if err != nil || stored_pubkey != pubkey {
+		t.Log("FileKeystore::GetPubkey() failed:", err)
+		t.Fail()
+	}
+
+	if _, err := ks.Unlock([]byte("wrong")); err != ErrKeystoreWrongPassphrase {
+		t.Log("FileKeystore::Unlock() accepted a wrong passphrase:", err)
+		t.Fail()
+	}
+
+	signer, err := ks.Unlock(passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.GetPubkey() != pubkey {
+		t.Log("FileKeystore::Unlock() returned a signer for another key.")
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestFileKeystore_SaveFixesPermissions(t *testing.T) {
+	saved := Cfg_keystore_encryptor
+	defer func() { Cfg_keystore_encryptor = saved }()
+	Cfg_keystore_encryptor.N = 1 << 10 // Fast, for testing only
+
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "key.json")
+	if err := ioutil.WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0644); err != nil { // Whatever the umask
+		t.Fatal(err)
+	}
+
+	_, seckey := cipher.GenerateKeyPair()
+	if err := NewFileKeystore(path).Save(seckey, []byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Log("FileKeystore::Save() left an existing keystore with mode", info.Mode().Perm())
+		t.Fail()
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Log("FileKeystore::Save() left temporary files behind:", len(entries), err)
+		t.Fail()
+	}
+}
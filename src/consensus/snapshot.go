@@ -0,0 +1,175 @@
+//nolint
+package consensus
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// Snapshot is a serializable, point-in-time view of a ConsensusParticipant
+// for tooling and tests. Hashes, signatures and pubkeys are in hex.
+//
+////////////////////////////////////////////////////////////////////////////////
+type BlockSnapshot struct {
+	Seqno   uint64 `json:"seqno"`
+	Hash    string `json:"hash"`
+	Sig     string `json:"sig"`
+	Support int    `json:"support"` // Distinct signers of the commit
+}
+
+type CandidateSnapshot struct {
+	Hash         string `json:"hash"`
+	Signer_count int    `json:"signer_count"`
+	Weight       uint64 `json:"weight"`
+}
+
+type BlockStatSnapshot struct {
+	Seqno         uint64              `json:"seqno"`
+	Frozen        bool                `json:"frozen"`
+	Accept_count  int                 `json:"accept_count"`
+	Reject_count  int                 `json:"reject_count"`
+	Neglect_count int                 `json:"neglect_count"`
+	Candidates    []CandidateSnapshot `json:"candidates"` // Best first
+}
+
+type CountersSnapshot struct {
+	Incoming_block_count       int `json:"incoming_block_count"`
+	Duplicate_suppressed_count int `json:"duplicate_suppressed_count"`
+	Forwarded_count            int `json:"forwarded_count"`
+	Pushed_count               int `json:"pushed_count"`
+	Reorg_count                int `json:"reorg_count"`
+}
+
+type ConfigSnapshot struct {
+	Blockchain_tail_length            int           `json:"blockchain_tail_length"`
+	Blockchain_max_reorg_depth        uint64        `json:"blockchain_max_reorg_depth"`
+	Consensus_candidate_max_seqno_gap uint64        `json:"consensus_candidate_max_seqno_gap"`
+	Consensus_waiting_time_as_seqno   uint64        `json:"consensus_waiting_time_as_seqno_diff"`
+	Consensus_max_candidate_messages  int           `json:"consensus_max_candidate_messages"`
+	Consensus_cast_votes              bool          `json:"consensus_cast_votes"`
+	Gossip_seen_cache_size            int           `json:"gossip_seen_cache_size"`
+	Gossip_fanout                     int           `json:"gossip_fanout"`
+	Flood_rate_per_second             float64       `json:"flood_rate_per_second"`
+	Flood_burst                       int           `json:"flood_burst"`
+	Flood_max_messages_per_peer_seqno int           `json:"flood_max_messages_per_peer_per_seqno"`
+	Flood_invalid_sig_ban_threshold   int           `json:"flood_invalid_sig_ban_threshold"`
+	Flood_ban_duration                time.Duration `json:"flood_ban_duration_ns"`
+}
+
+type ParticipantSnapshot struct {
+	Pubkey     string              `json:"pubkey"` // Empty if watch-only
+	Watch_only bool                `json:"watch_only"`
+	Next_seqno uint64              `json:"next_seqno"`
+	Tail       []BlockSnapshot     `json:"tail"`       // Oldest first
+	Candidates []BlockStatSnapshot `json:"candidates"` // By increasing seqno
+	Counters   CountersSnapshot    `json:"counters"`
+	Config     ConfigSnapshot      `json:"config"`
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *ConsensusParticipant) Snapshot() *ParticipantSnapshot {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	snap := &ParticipantSnapshot{
+		Watch_only: self.signer == nil,
+		Next_seqno: self.block_queue.GetNextSeqNo(),
+		Tail:       []BlockSnapshot{},
+		Candidates: []BlockStatSnapshot{},
+		Counters: CountersSnapshot{
+			Incoming_block_count:       int(self.metrics.Headers_received),
+			Duplicate_suppressed_count: int(self.metrics.Duplicates_suppressed),
+			Forwarded_count:            int(self.metrics.Headers_forwarded),
+			Pushed_count:               int(self.metrics.Pushes),
+			Reorg_count:                int(self.metrics.Reorgs),
+		},
+		Config: get_config_snapshot(),
+	}
+	if self.signer != nil {
+		snap.Pubkey = self.Pubkey.Hex()
+	}
+
+	for _, blockPtr := range self.block_queue.blockPtr_slice {
+		snap.Tail = append(snap.Tail, BlockSnapshot{
+			Seqno:   blockPtr.Seqno,
+			Hash:    blockPtr.Hash.Hex(),
+			Sig:     blockPtr.Sig.Hex(),
+			Support: self.block_queue.get_support(blockPtr.Hash),
+		})
+	}
+
+	for _, statPtr := range self.block_stat_queue.queue {
+		snap.Candidates = append(snap.Candidates, statPtr.snapshot())
+	}
+
+	return snap
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *BlockStat) snapshot() BlockStatSnapshot {
+	snap := BlockStatSnapshot{
+		Seqno:         self.seqno,
+		Frozen:        self.frozen,
+		Accept_count:  self.accept_count,
+		Reject_count:  self.debug_reject_count,
+		Neglect_count: self.debug_neglect_count,
+		Candidates:    []CandidateSnapshot{},
+	}
+	for hash, info := range self.hash2info {
+		snap.Candidates = append(snap.Candidates, CandidateSnapshot{
+			Hash:         hash.Hex(),
+			Signer_count: info.Support(),
+			Weight:       info.Weight(),
+		})
+	}
+	// In the order of is_better_candidate(); hex strings compare as the
+	// hashes they encode:
+	sort.Slice(snap.Candidates, func(i, j int) bool {
+		a, b := snap.Candidates[i], snap.Candidates[j]
+		if a.Signer_count != b.Signer_count {
+			return a.Signer_count > b.Signer_count
+		}
+		if a.Weight != b.Weight {
+			return a.Weight > b.Weight
+		}
+		return a.Hash < b.Hash
+	})
+	return snap
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func get_config_snapshot() ConfigSnapshot {
+	return ConfigSnapshot{
+		Blockchain_tail_length:            Cfg_blockchain_tail_length,
+		Blockchain_max_reorg_depth:        Cfg_blockchain_max_reorg_depth,
+		Consensus_candidate_max_seqno_gap: Cfg_consensus_candidate_max_seqno_gap,
+		Consensus_waiting_time_as_seqno:   Cfg_consensus_waiting_time_as_seqno_diff,
+		Consensus_max_candidate_messages:  Cfg_consensus_max_candidate_messages,
+		Consensus_cast_votes:              Cfg_consensus_cast_votes,
+		Gossip_seen_cache_size:            Cfg_gossip_seen_cache_size,
+		Gossip_fanout:                     Cfg_gossip_fanout,
+		Flood_rate_per_second:             Cfg_flood_rate_per_second,
+		Flood_burst:                       Cfg_flood_burst,
+		Flood_max_messages_per_peer_seqno: Cfg_flood_max_messages_per_peer_per_seqno,
+		Flood_invalid_sig_ban_threshold:   Cfg_flood_invalid_sig_ban_threshold,
+		Flood_ban_duration:                Cfg_flood_ban_duration,
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Indented JSON, for dumping to a file or terminal.
+func (self *ParticipantSnapshot) ToJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(self); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -0,0 +1,113 @@
+//nolint
+package consensus
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/cipher/secp256k1-go"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_Snapshot(t *testing.T) {
+	n_signers := 3
+	n_seqno := 10
+
+	hashes, headers := make_signed_headers(n_signers, n_seqno)
+
+	p := NewConsensusParticipantPtr(&discardConnectionManager{}, NewRandomMemorySigner())
+	for seqno := 0; seqno < n_seqno; seqno++ {
+		for i := 0; i < n_signers; i++ {
+			p.OnBlockHeaderArrived(headers[i][seqno])
+		}
+	}
+	p.OnBlockHeaderArrived(headers[0][0]) // Duplicate
+
+	snap := p.Snapshot()
+
+	n_committed := n_seqno - int(Cfg_consensus_waiting_time_as_seqno_diff)
+	if len(snap.Tail) != n_committed || snap.Next_seqno != uint64(n_committed+1) {
+		t.Log("Snapshot has", len(snap.Tail), "tail blocks.")
+		t.Fail()
+	}
+	for i, b := range snap.Tail {
+		// Each block is supported by the signers plus our own vote:
+		if b.Hash != hashes[i+1].Hex() || b.Support != n_signers+1 {
+			t.Log("Snapshot tail block", i, "is", b)
+			t.Fail()
+		}
+	}
+
+	if len(snap.Candidates) != n_seqno {
+		t.Log("Snapshot has", len(snap.Candidates), "candidates.")
+		t.Fail()
+	}
+	last := snap.Candidates[n_seqno-1]
+	if last.Frozen || len(last.Candidates) != 1 ||
+		last.Candidates[0].Signer_count != n_signers+1 {
+		t.Log("Snapshot candidate tally is", last)
+		t.Fail()
+	}
+
+	if snap.Pubkey != p.Pubkey.Hex() || snap.Watch_only ||
+		snap.Counters.Incoming_block_count != n_signers*n_seqno+1 ||
+		snap.Counters.Duplicate_suppressed_count != 1 ||
+		snap.Config.Blockchain_tail_length != Cfg_blockchain_tail_length {
+		t.Log("Snapshot header is", snap.Pubkey, snap.Counters, snap.Config)
+		t.Fail()
+	}
+
+	data, err := snap.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ParticipantSnapshot
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Tail) != len(snap.Tail) || decoded.Tail[0] != snap.Tail[0] ||
+		decoded.Counters != snap.Counters || decoded.Config != snap.Config {
+		t.Log("Snapshot does not survive a JSON round trip:", string(data))
+		t.Fail()
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func TestConsensusParticipant_SnapshotSupport(t *testing.T) {
+	saved := Cfg_consensus_max_candidate_messages
+	defer func() { Cfg_consensus_max_candidate_messages = saved }()
+	Cfg_consensus_max_candidate_messages = 2
+
+	n_seqno := 10
+	seckeys := make([]cipher.SecKey, 4)
+	for i := range seckeys {
+		_, seckeys[i] = cipher.GenerateKeyPair()
+	}
+
+	p := NewConsensusParticipantPtr(&discardConnectionManager{}, nil)
+	for seqno := 1; seqno <= n_seqno; seqno++ {
+		hash := cipher.SumSHA256(secp256k1.RandByte(888))
+		// The first signer signs twice, with different signatures; the
+		// last two arrive past the candidate message limit:
+		for _, i := range []int{0, 1, 0, 2, 3} {
+			p.OnBlockHeaderArrived(&BlockBase{
+				Sig:   cipher.MustSignHash(hash, seckeys[i]),
+				Hash:  hash,
+				Seqno: uint64(seqno),
+			})
+		}
+	}
+
+	snap := p.Snapshot()
+	if len(snap.Tail) == 0 {
+		t.Fatal("Snapshot has no tail blocks.")
+	}
+	for i, b := range snap.Tail {
+		if b.Support != len(seckeys) {
+			t.Log("Snapshot tail block", i, "has support", b.Support,
+				"expected", len(seckeys))
+			t.Fail()
+		}
+	}
+}
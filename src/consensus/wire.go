@@ -0,0 +1,46 @@
+//nolint
+package consensus
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+//
+// Wire format of a block header: Sig, Hash, then Seqno as big-endian
+// uint64. Nothing is checked beyond the size; a decoded header still goes
+// through the usual checks on arrival.
+//
+////////////////////////////////////////////////////////////////////////////////
+const BlockBaseEncodedSize = len(cipher.Sig{}) + len(cipher.SHA256{}) + 8
+
+var ErrHeaderSize = errors.New("consensus: block header has wrong size")
+
+////////////////////////////////////////////////////////////////////////////////
+func (self *BlockBase) Encode() []byte {
+	data := make([]byte, 0, BlockBaseEncodedSize)
+	data = append(data, self.Sig[:]...)
+	data = append(data, self.Hash[:]...)
+
+	var seqno [8]byte
+	binary.BigEndian.PutUint64(seqno[:], self.Seqno)
+	return append(data, seqno[:]...)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func DecodeBlockBase(data []byte) (*BlockBase, error) {
+	if len(data) != BlockBaseEncodedSize {
+		return nil, ErrHeaderSize
+	}
+
+	blockPtr := &BlockBase{}
+	n := copy(blockPtr.Sig[:], data)
+	n += copy(blockPtr.Hash[:], data[n:])
+	blockPtr.Seqno = binary.BigEndian.Uint64(data[n:])
+	return blockPtr, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
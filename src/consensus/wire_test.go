@@ -0,0 +1,69 @@
+//nolint
+package consensus
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+	"github.com/skycoin/skycoin/src/cipher/secp256k1-go"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+func TestBlockBase_EncodeDecode(t *testing.T) {
+	_, seckey := cipher.GenerateKeyPair()
+	hash := cipher.SumSHA256(secp256k1.RandByte(888))
+	b := BlockBase{Sig: cipher.MustSignHash(hash, seckey), Hash: hash, Seqno: 1<<40 + 7}
+
+	data := b.Encode()
+	if len(data) != BlockBaseEncodedSize {
+		t.Log("BlockBase::Encode() gave", len(data), "bytes")
+		t.Fail()
+	}
+
+	decoded, err := DecodeBlockBase(data)
+	if err != nil || *decoded != b {
+		t.Log("DecodeBlockBase() did not reverse BlockBase::Encode():", err)
+		t.Fail()
+	}
+
+	for _, n := range []int{0, BlockBaseEncodedSize - 1, BlockBaseEncodedSize + 1} {
+		if _, err := DecodeBlockBase(make([]byte, n)); err != ErrHeaderSize {
+			t.Log("DecodeBlockBase() accepted", n, "bytes")
+			t.Fail()
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+func FuzzDecodeBlockBase(f *testing.F) {
+	_, seckey := cipher.GenerateKeyPair()
+	hash := cipher.SumSHA256([]byte("seed"))
+	seed := BlockBase{Sig: cipher.MustSignHash(hash, seckey), Hash: hash, Seqno: 1}
+	f.Add(seed.Encode())
+	f.Add(make([]byte, BlockBaseEncodedSize))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		blockPtr, err := DecodeBlockBase(data)
+		if err != nil {
+			if len(data) == BlockBaseEncodedSize {
+				t.Fatal("DecodeBlockBase() rejected a header of the right size:", err)
+			}
+			return
+		}
+		if !bytes.Equal(blockPtr.Encode(), data) {
+			t.Fatal("BlockBase::Encode() did not reverse DecodeBlockBase()")
+		}
+
+		// Whatever was decoded must be safe to hand to a participant:
+		p := NewWatchOnlyConsensusParticipantPtr(&discardConnectionManager{})
+		p.OnBlockHeaderArrived(blockPtr)
+		p.OnBlockHeaderArrived(blockPtr)
+		if p.Get_block_stat_queue_Len() > 1 {
+			t.Fatal("One header made", p.Get_block_stat_queue_Len(), "BlockStats")
+		}
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -1,7 +1,8 @@
-package main
+package engine
 
 import (
 	"fmt"
+	"math/rand"
 )
 
 type BlockRecordTree struct {
@@ -27,7 +28,7 @@ func (brt *BlockRecordTree) GetAllBlockRecords() []*BlockRecord {
 	return blockRecordArray
 }
 
-func NewRandomBlockRecordTree(totalBlocks int, childrenPerNode int) (*BlockRecordTree, error) {
+func NewRandomBlockRecordTree(rng *rand.Rand, totalBlocks int, childrenPerNode int) (*BlockRecordTree, error) {
 	if totalBlocks < 1 {
 		return nil, fmt.Errorf("totalBlocks must be greater than 0")
 	}
@@ -37,7 +38,7 @@ func NewRandomBlockRecordTree(totalBlocks int, childrenPerNode int) (*BlockRecor
 	}
 
 	blockRecordTree := &BlockRecordTree{}
-	blockRecordTree.Root = NewRandomBlockRecord()
+	blockRecordTree.Root = NewRandomBlockRecord(rng)
 
 	// queue is needed for breadth first tree traversal
 	queue := []*BlockRecord{}
@@ -48,7 +49,7 @@ func NewRandomBlockRecordTree(totalBlocks int, childrenPerNode int) (*BlockRecor
 	for n < totalBlocks {
 		currentRoot := queue[0]
 
-		br := NewRandomBlockRecord()
+		br := NewRandomBlockRecord(rng)
 
 		if len(currentRoot.children) < childrenPerNode {
 			br.parent = currentRoot
@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"math/rand"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+type BlockRecord struct {
+	hash     cipher.SHA256  // Hash of the Block
+	seqNo    int            // SeqNo of the block
+	parent   *BlockRecord   // Pointer to the parent of the block record
+	children []*BlockRecord // List of children of the block record
+}
+
+func (br *BlockRecord) GetHash() cipher.SHA256 {
+	return br.hash
+}
+
+func (br *BlockRecord) GetSeqNo() int {
+	return br.seqNo
+}
+
+// nil for the root of the tree
+func (br *BlockRecord) GetParent() *BlockRecord {
+	return br.parent
+}
+
+func (br *BlockRecord) GetChildren() []*BlockRecord {
+	return append([]*BlockRecord{}, br.children...)
+}
+
+func NewRandomBlockRecord(rng *rand.Rand) *BlockRecord {
+	blockRecord := &BlockRecord{}
+	blockRecord.hash = GetRandomSHA256(rng)
+	blockRecord.seqNo = 0
+	blockRecord.parent = nil
+	blockRecord.children = []*BlockRecord{}
+	return blockRecord
+}
@@ -0,0 +1,113 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+// All nodes give every block the same weight, of 0.0 or 1.0; with an
+// epsilon, the weights of each block are within it of each other and of
+// 0.0 or 1.0
+const CONVERGENCE_MODE_WEIGHTS = "weights"
+
+// All nodes agree on the same leaf path, following the heaviest child
+// from the root
+const CONVERGENCE_MODE_ARGMAX = "argmax"
+
+type ConvergenceCriterion struct {
+	Mode string // CONVERGENCE_MODE_WEIGHTS or CONVERGENCE_MODE_ARGMAX
+
+	// Weights that differ by at most Epsilon count as the same. 0.0 is
+	// exact equality.
+	Epsilon float64
+
+	// The number of consecutive iterations the criterion must hold for;
+	// 0 and 1 both mean the first iteration it holds.
+	Window int
+}
+
+// Exact equality, as soon as it holds
+func DefaultConvergenceCriterion() ConvergenceCriterion {
+	return ConvergenceCriterion{Mode: CONVERGENCE_MODE_WEIGHTS, Epsilon: 0.0, Window: 1}
+}
+
+func (c *ConvergenceCriterion) Validate() error {
+	if c.Mode != CONVERGENCE_MODE_WEIGHTS && c.Mode != CONVERGENCE_MODE_ARGMAX {
+		return fmt.Errorf("unknown convergence mode %q (must be %s or %s)", c.Mode,
+			CONVERGENCE_MODE_WEIGHTS, CONVERGENCE_MODE_ARGMAX)
+	}
+	if c.Epsilon < 0.0 || c.Epsilon >= 0.5 {
+		return fmt.Errorf("convergence epsilon must be in [0, 0.5), got %v", c.Epsilon)
+	}
+	if c.Window < 0 {
+		return fmt.Errorf("convergence window must not be negative, got %d", c.Window)
+	}
+	return nil
+}
+
+// Whether the nodes have converged now, by sim.Convergence; the stability
+// window is not considered.
+func (sim *Simulation) CheckConvergence() bool {
+	if sim.Convergence.Mode == CONVERGENCE_MODE_ARGMAX {
+		return sim.checkArgmaxConvergence()
+	}
+	return sim.checkWeightsConvergence()
+}
+
+// Per block, the spread (max - min) of the nodes' weights, as in
+// ComputeMetrics, must be at most eps, and the weights all 0.0 or all 1.0
+// within eps
+func (sim *Simulation) checkWeightsConvergence() bool {
+	eps := sim.Convergence.Epsilon
+
+	for _, block := range sim.RootBlockTree.GetAllBlockRecords() {
+		minWeight, maxWeight := math.Inf(1), math.Inf(-1)
+		for _, node := range sim.Nodes {
+			weight := node.state[block.hash].weight
+			minWeight = math.Min(minWeight, weight)
+			maxWeight = math.Max(maxWeight, weight)
+		}
+
+		if maxWeight-minWeight > eps {
+			return false
+		}
+		if math.Max(math.Abs(minWeight), math.Abs(maxWeight)) > eps &&
+			math.Max(math.Abs(minWeight-1.0), math.Abs(maxWeight-1.0)) > eps {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (sim *Simulation) checkArgmaxConvergence() bool {
+	firstLeaf := sim.Nodes[0].GetArgmaxLeaf(sim.RootBlockTree, sim.Convergence.Epsilon)
+
+	for _, node := range sim.Nodes[1:] {
+		if node.GetArgmaxLeaf(sim.RootBlockTree, sim.Convergence.Epsilon) != firstLeaf {
+			return false
+		}
+	}
+	return true
+}
+
+// The leaf reached from the root by following the heaviest child. A child
+// replaces an earlier one only if it is more than eps heavier, so children
+// within eps of each other are a tie, which is broken by tree order.
+func (n *Node) GetArgmaxLeaf(brt *BlockRecordTree, eps float64) cipher.SHA256 {
+	block := brt.Root
+
+	for len(block.children) > 0 {
+		heaviest := block.children[0]
+		for _, child := range block.children[1:] {
+			if n.state[child.hash].weight > n.state[heaviest.hash].weight+eps {
+				heaviest = child
+			}
+		}
+		block = heaviest
+	}
+
+	return block.hash
+}
@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"testing"
+)
+
+func TestCheckConvergence(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		epsilon float64
+		weights [][3]float64
+		want    bool
+	}{
+		{"settled", CONVERGENCE_MODE_WEIGHTS, 0.0, [][3]float64{{1, 1, 0}, {1, 1, 0}, {1, 1, 0}}, true},
+		{"near settled, exact", CONVERGENCE_MODE_WEIGHTS, 0.0, [][3]float64{{1, 1, 0}, {1, 0.995, 0.005}, {1, 1, 0}}, false},
+		{"near settled, within epsilon", CONVERGENCE_MODE_WEIGHTS, 0.01, [][3]float64{{1, 1, 0}, {1, 0.995, 0.005}, {1, 1, 0}}, true},
+		// Each node is within epsilon of the first, but the spread is not
+		// (binary fractions, so that the spread is exact):
+		{"spread above epsilon", CONVERGENCE_MODE_WEIGHTS, 0.03125,
+			[][3]float64{{1, 0.96875, 0.03125}, {1, 0.9375, 0.0625}, {1, 1, 0}}, false},
+		{"spread at epsilon", CONVERGENCE_MODE_WEIGHTS, 0.0625,
+			[][3]float64{{1, 0.96875, 0.03125}, {1, 0.9375, 0.0625}, {1, 1, 0}}, true},
+		{"agreed on an even split", CONVERGENCE_MODE_WEIGHTS, 0.01, [][3]float64{{1, 0.5, 0.5}, {1, 0.5, 0.5}, {1, 0.5, 0.5}}, false},
+		{"argmax agreed", CONVERGENCE_MODE_ARGMAX, 0.0, [][3]float64{{1, 0.9, 0.1}, {1, 0.6, 0.4}, {1, 1, 0}}, true},
+		{"argmax disagreed", CONVERGENCE_MODE_ARGMAX, 0.0, [][3]float64{{1, 0.9, 0.1}, {1, 0.4, 0.6}, {1, 1, 0}}, false},
+		// Within epsilon, the tie goes to the first leaf for every node:
+		{"argmax tie within epsilon", CONVERGENCE_MODE_ARGMAX, 0.05,
+			[][3]float64{{1, 0.5, 0.5}, {1, 0.52, 0.48}, {1, 0.48, 0.52}}, true},
+		{"argmax tie, exact", CONVERGENCE_MODE_ARGMAX, 0.0,
+			[][3]float64{{1, 0.5, 0.5}, {1, 0.52, 0.48}, {1, 0.48, 0.52}}, false},
+	}
+
+	for _, test := range tests {
+		sim := newFixtureSimulation(t, test.weights)
+		sim.Convergence = ConvergenceCriterion{Mode: test.mode, Epsilon: test.epsilon, Window: 1}
+
+		if got := sim.CheckConvergence(); got != test.want {
+			t.Log(test.name, "converged:", got, "want", test.want)
+			t.Fail()
+		}
+	}
+}
+
+func TestGetArgmaxLeaf_Tie(t *testing.T) {
+	sim := newFixtureSimulation(t, [][3]float64{{1, 0.48, 0.52}, {1, 0.4, 0.6}, {1, 0.5, 0.5}})
+	leaves := sim.RootBlockTree.Root.children
+
+	tests := []struct {
+		node    int
+		epsilon float64
+		want    *BlockRecord
+	}{
+		{0, 0.05, leaves[0]}, // Within epsilon: the first in tree order
+		{0, 0.0, leaves[1]},
+		{1, 0.05, leaves[1]}, // More than epsilon heavier
+		{2, 0.0, leaves[0]},  // An exact tie
+	}
+
+	for _, test := range tests {
+		if got := sim.Nodes[test.node].GetArgmaxLeaf(sim.RootBlockTree, test.epsilon); got != test.want.hash {
+			t.Log("Node", test.node, "epsilon", test.epsilon, "argmax leaf", got.Hex(), "want", test.want.hash.Hex())
+			t.Fail()
+		}
+	}
+}
+
+func TestObserveConvergence_Window(t *testing.T) {
+	tests := []struct {
+		name      string
+		window    int
+		converged []bool
+		want      int
+	}{
+		{"window 0 is 1", 0, []bool{false, true}, 1},
+		{"window 1", 1, []bool{false, false, true, true}, 2},
+		{"window 3", 3, []bool{true, true, true, true}, 0},
+		{"too short", 3, []bool{false, true, true}, -1},
+		// The streak starts again after an iteration without convergence:
+		{"reset", 3, []bool{true, true, false, true, true, true}, 3},
+		{"reset, too short", 3, []bool{true, true, false, true, true}, -1},
+	}
+
+	for _, test := range tests {
+		sim := NewSimulation(nil)
+		sim.Convergence.Window = test.window
+		sim.ConvergedIteration = -1
+
+		for it, converged := range test.converged {
+			if sim.ConvergedIteration == -1 {
+				sim.observeConvergence(it, converged)
+			}
+		}
+		if sim.ConvergedIteration != test.want {
+			t.Log(test.name, "converged at", sim.ConvergedIteration, "want", test.want)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package engine
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Convergence metrics over all nodes, after some iterations
+type IterationMetrics struct {
+	Iteration int `json:"iteration"` // Iterations run so far
+
+	// Per block, the spread (max - min) of the weights the nodes give it;
+	// the largest, and the mean over all blocks:
+	MaxDisagreement  float64 `json:"max_disagreement"`
+	MeanDisagreement float64 `json:"mean_disagreement"`
+
+	// Per node, the entropy in bits of its weights of the leaf blocks,
+	// which sum to the weight of the root; the mean and the largest over
+	// all nodes. 0 once a node has settled on one branch.
+	MeanEntropy float64 `json:"mean_entropy"`
+	MaxEntropy  float64 `json:"max_entropy"`
+
+	// Blocks to which every node gives the same weight of 0.0 or 1.0
+	SettledBlocks int `json:"settled_blocks"`
+
+	// Per block, the consensus is 1.0 if the mean weight of the nodes is at
+	// least 0.5, else 0.0; the largest distance of any node's weight from
+	// it. 0 exactly when the nodes have converged by weights, with no
+	// epsilon.
+	DistanceToConsensus float64 `json:"distance_to_consensus"`
+}
+
+var iterationMetricsHeader = []string{"iteration", "max_disagreement", "mean_disagreement", "mean_entropy",
+	"max_entropy", "settled_blocks", "distance_to_consensus"}
+
+func (m *IterationMetrics) csvRow() []string {
+	f := func(x float64) string { return strconv.FormatFloat(x, 'g', -1, 64) }
+	return []string{strconv.Itoa(m.Iteration), f(m.MaxDisagreement), f(m.MeanDisagreement), f(m.MeanEntropy),
+		f(m.MaxEntropy), strconv.Itoa(m.SettledBlocks), f(m.DistanceToConsensus)}
+}
+
+// Computes the metrics of the current state of all nodes
+func (sim *Simulation) ComputeMetrics() IterationMetrics {
+	metrics := IterationMetrics{Iteration: sim.Iteration}
+
+	allBlocks := sim.RootBlockTree.GetAllBlockRecords()
+
+	for _, block := range allBlocks {
+		minWeight, maxWeight, sumWeight := math.Inf(1), math.Inf(-1), 0.0
+		settled := true
+
+		for _, node := range sim.Nodes {
+			weight := node.state[block.hash].weight
+			minWeight = math.Min(minWeight, weight)
+			maxWeight = math.Max(maxWeight, weight)
+			sumWeight += weight
+			if weight != 0.0 && weight != 1.0 {
+				settled = false
+			}
+		}
+
+		disagreement := maxWeight - minWeight
+		metrics.MaxDisagreement = math.Max(metrics.MaxDisagreement, disagreement)
+		metrics.MeanDisagreement += disagreement / float64(len(allBlocks))
+
+		if settled && disagreement == 0.0 {
+			metrics.SettledBlocks++
+		}
+
+		consensus := 0.0
+		if sumWeight/float64(len(sim.Nodes)) >= 0.5 {
+			consensus = 1.0
+		}
+		distance := math.Max(math.Abs(maxWeight-consensus), math.Abs(minWeight-consensus))
+		metrics.DistanceToConsensus = math.Max(metrics.DistanceToConsensus, distance)
+	}
+
+	for _, node := range sim.Nodes {
+		entropy := node.GetBranchEntropy()
+		metrics.MeanEntropy += entropy / float64(len(sim.Nodes))
+		metrics.MaxEntropy = math.Max(metrics.MaxEntropy, entropy)
+	}
+
+	return metrics
+}
+
+// The entropy in bits of the node's weights of the leaf blocks
+func (n *Node) GetBranchEntropy() float64 {
+	// In tree order, not map order, so the sum is the same every run:
+	entropy := 0.0
+	for _, block := range n.sim.RootBlockTree.GetAllBlockRecords() {
+		weight := n.GetWeight(block.hash)
+		if len(block.children) == 0 && weight > 0.0 {
+			entropy -= weight * math.Log2(weight)
+		}
+	}
+	// Rounding can make a settled node's entropy slightly negative:
+	return math.Max(entropy, 0.0)
+}
+
+// The metrics time series of a run, summarized
+type MetricsSummary struct {
+	Iterations         int              `json:"iterations"`
+	ConvergedIteration int              `json:"converged_iteration"` // -1 if not converged
+	Initial            IterationMetrics `json:"initial"`
+	Final              IterationMetrics `json:"final"`
+
+	// The closest the nodes got to consensus, and when:
+	MinDistanceToConsensus float64 `json:"min_distance_to_consensus"`
+	MinDistanceIteration   int     `json:"min_distance_iteration"`
+}
+
+// Summarizes sim.Metrics. Returns the zero summary if there are none.
+func (sim *Simulation) SummarizeMetrics() MetricsSummary {
+	summary := MetricsSummary{Iterations: sim.Iteration, ConvergedIteration: sim.ConvergedIteration}
+	if len(sim.Metrics) == 0 {
+		return summary
+	}
+
+	summary.Initial = sim.Metrics[0]
+	summary.Final = sim.Metrics[len(sim.Metrics)-1]
+	summary.MinDistanceToConsensus = summary.Initial.DistanceToConsensus
+	summary.MinDistanceIteration = summary.Initial.Iteration
+
+	for _, metrics := range sim.Metrics {
+		if metrics.DistanceToConsensus < summary.MinDistanceToConsensus {
+			summary.MinDistanceToConsensus = metrics.DistanceToConsensus
+			summary.MinDistanceIteration = metrics.Iteration
+		}
+	}
+
+	return summary
+}
+
+func (s *MetricsSummary) Fprint(w io.Writer) error {
+	fmt.Fprintf(w, "\n#begin Convergence Metrics Summary:\n")
+	fmt.Fprintf(w, "Iterations:%d ConvergedIteration:%d\n", s.Iterations, s.ConvergedIteration)
+	fmt.Fprintln(w, "Metrics [Format: iteration | maxDisagreement | meanDisagreement | meanEntropy | maxEntropy | settledBlocks | distanceToConsensus]:")
+	for _, m := range []IterationMetrics{s.Initial, s.Final} {
+		fmt.Fprintf(w, "%d | %.4f | %.4f | %.4f | %.4f | %d | %.4f\n", m.Iteration, m.MaxDisagreement, m.MeanDisagreement,
+			m.MeanEntropy, m.MaxEntropy, m.SettledBlocks, m.DistanceToConsensus)
+	}
+	fmt.Fprintf(w, "Min Distance To Consensus: %.4f at Iteration %d\n", s.MinDistanceToConsensus, s.MinDistanceIteration)
+	_, err := fmt.Fprintf(w, "#end Convergence Metrics Summary\n")
+	return err
+}
+
+// Writes sim.Metrics as JSON lines, or as CSV with a header row
+func (sim *Simulation) WriteMetrics(mode string, w io.Writer) error {
+	switch mode {
+	case OUTPUT_MODE_JSON:
+		encoder := json.NewEncoder(w)
+		for _, metrics := range sim.Metrics {
+			if err := encoder.Encode(&metrics); err != nil {
+				return err
+			}
+		}
+		return nil
+	case OUTPUT_MODE_CSV:
+		writer := csv.NewWriter(w)
+		writer.Write(iterationMetricsHeader)
+		for _, metrics := range sim.Metrics {
+			writer.Write(metrics.csvRow())
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return fmt.Errorf("unknown metrics mode %q (must be %s or %s)", mode, OUTPUT_MODE_JSON, OUTPUT_MODE_CSV)
+}
@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// A simulation of a root block with two leaves, in which node i gives the
+// root, the first and the second leaf the weights of weights[i]
+func newFixtureSimulation(t *testing.T, weights [][3]float64) *Simulation {
+	sim := NewSimulation(rand.New(rand.NewSource(1)))
+	sim.Output = &TextOutput{w: io.Discard}
+	if err := sim.InitSimulation(3, 2, len(weights), 1, 1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := sim.RootBlockTree.GetAllBlockRecords()
+	if len(blocks) != 3 || len(blocks[0].children) != 2 {
+		t.Fatal("The fixture tree is not a root with two leaves")
+	}
+	for i, node := range sim.Nodes {
+		for j, block := range blocks {
+			node.state[block.hash].weight = weights[i][j]
+		}
+	}
+	return sim
+}
+
+func TestComputeMetrics_Settled(t *testing.T) {
+	sim := newFixtureSimulation(t, [][3]float64{{1, 1, 0}, {1, 1, 0}, {1, 1, 0}})
+
+	m := sim.ComputeMetrics()
+	if m.MaxDisagreement != 0 || m.MeanDisagreement != 0 || m.MeanEntropy != 0 || m.MaxEntropy != 0 ||
+		m.SettledBlocks != 3 || m.DistanceToConsensus != 0 {
+		t.Log("Settled nodes have metrics", m)
+		t.Fail()
+	}
+	for _, node := range sim.Nodes {
+		if entropy := node.GetBranchEntropy(); entropy != 0 {
+			t.Log("Node", node.id, "has entropy", entropy)
+			t.Fail()
+		}
+	}
+}
+
+func TestComputeMetrics_EvenSplit(t *testing.T) {
+	sim := newFixtureSimulation(t, [][3]float64{{1, 0.5, 0.5}, {1, 0.5, 0.5}, {1, 0.5, 0.5}})
+
+	for _, node := range sim.Nodes {
+		if entropy := node.GetBranchEntropy(); math.Abs(entropy-1.0) > 1e-12 {
+			t.Log("Node", node.id, "has entropy", entropy, "want 1 bit")
+			t.Fail()
+		}
+	}
+
+	m := sim.ComputeMetrics()
+	// Only the root is settled; a mean weight of 0.5 has consensus 1.0:
+	if m.MaxDisagreement != 0 || math.Abs(m.MeanEntropy-1.0) > 1e-12 || math.Abs(m.MaxEntropy-1.0) > 1e-12 ||
+		m.SettledBlocks != 1 || m.DistanceToConsensus != 0.5 {
+		t.Log("Evenly split nodes have metrics", m)
+		t.Fail()
+	}
+}
+
+func TestComputeMetrics_Disagreement(t *testing.T) {
+	sim := newFixtureSimulation(t, [][3]float64{{1, 1, 0}, {1, 0, 1}, {1, 1, 0}, {1, 0.75, 0.25}})
+
+	m := sim.ComputeMetrics()
+	// Both leaves have a spread of 1; the first has a mean of 0.6875, so
+	// consensus 1.0, and the second node's weight of 0 is 1 from it:
+	if m.MaxDisagreement != 1 || math.Abs(m.MeanDisagreement-2.0/3.0) > 1e-12 || m.SettledBlocks != 1 ||
+		m.DistanceToConsensus != 1 {
+		t.Log("Disagreeing nodes have metrics", m)
+		t.Fail()
+	}
+
+	// Only the last node is not settled on a branch:
+	want := -(0.75*math.Log2(0.75) + 0.25*math.Log2(0.25))
+	if math.Abs(m.MaxEntropy-want) > 1e-12 || math.Abs(m.MeanEntropy-want/4) > 1e-12 {
+		t.Log("Disagreeing nodes have entropies", m.MeanEntropy, m.MaxEntropy, "want max", want)
+		t.Fail()
+	}
+}
+
+func TestSummarizeMetrics(t *testing.T) {
+	sim := newFixtureSimulation(t, [][3]float64{{1, 1, 0}, {1, 1, 0}, {1, 1, 0}})
+	sim.Iteration = 4
+	sim.ConvergedIteration = 2
+	sim.Metrics = []IterationMetrics{
+		{Iteration: 0, DistanceToConsensus: 1.0},
+		{Iteration: 1, DistanceToConsensus: 0.5},
+		{Iteration: 2, DistanceToConsensus: 0.0},
+		{Iteration: 3, DistanceToConsensus: 0.0},
+		{Iteration: 4, DistanceToConsensus: 0.25},
+	}
+
+	s := sim.SummarizeMetrics()
+	// The first iteration at the closest distance:
+	if s.Iterations != 4 || s.ConvergedIteration != 2 || s.Initial != sim.Metrics[0] || s.Final != sim.Metrics[4] ||
+		s.MinDistanceToConsensus != 0.0 || s.MinDistanceIteration != 2 {
+		t.Log("Summary is", s)
+		t.Fail()
+	}
+
+	sim.Metrics = nil
+	if s := sim.SummarizeMetrics(); s != (MetricsSummary{Iterations: 4, ConvergedIteration: 2}) {
+		t.Log("Summary of no metrics is", s)
+		t.Fail()
+	}
+}
@@ -1,15 +1,31 @@
-package main
+package engine
 
 type NodeStateBlockMeta struct {
 	blockRecord *BlockRecord // The corresponding BlockRecord from the tree
 	seqNo       int          // Here we maintain the highest seqNo among the nodes considered while syncing the states
-	ticks       int          // capture the ticks from the global simulation at the time when the NodeStateBlockMeta was synced
+	ticks       int          // capture the ticks from the node's simulation at the time when the NodeStateBlockMeta was synced
 	weight      float64      // weight of NodeStateBlockMeta. This weight will be sum of the weight of the children of the blockRecord
 }
 
 func (n *NodeStateBlockMeta) VerifyNodeStateBlockMeta() {
 }
 
+func (n *NodeStateBlockMeta) GetBlockRecord() *BlockRecord {
+	return n.blockRecord
+}
+
+func (n *NodeStateBlockMeta) GetSeqNo() int {
+	return n.seqNo
+}
+
+func (n *NodeStateBlockMeta) GetTicks() int {
+	return n.ticks
+}
+
+func (n *NodeStateBlockMeta) GetWeight() float64 {
+	return n.weight
+}
+
 func NewNodeStateBlockMeta(blockRecord *BlockRecord) *NodeStateBlockMeta {
 	return &NodeStateBlockMeta{blockRecord: blockRecord, seqNo: 0, ticks: 0, weight: 0}
 }
@@ -1,37 +1,84 @@
-package main
+package engine
 
 import (
 	"fmt"
+	"io"
 	"math"
 	"math/rand"
+	"os"
 
 	"github.com/skycoin/skycoin/src/cipher"
 )
 
-// The rate at which the nodes should approach the consensus
+// The default rate at which the nodes should approach the consensus
 const CONSENSUS_APPROACH_FACTOR = 0.1
+// The default spread of the initial weights around an even split
 const WEIGHT_INIT_FACTOR = 0.01
 
 type Node struct {
+	sim           *Simulation                           // Simulation the node belongs to
 	id            int                                   // id of the node
 	pubKey        cipher.PubKey                         // Node's public key
 	seqNo         int                                   // Node's sequence number tracking the number of updates done on the node
 	subscriptions []*Node                               // List of Nodes subscribed by the current Node
 	state         map[cipher.SHA256]*NodeStateBlockMeta // A mapping from BlockRecord Hash to current Node's separate copy of NodeStateBlockMeta
+	updateRule    UpdateRule                            // How the node moves its weights towards consensus
+	trust         []float64                             // Trust in each of the subscriptions, in the same order
 }
 
-func NewRandomNode(id int) *Node {
-	node := &Node{id: id}
-	node.pubKey = GetRandomPubKey()
+func NewRandomNode(sim *Simulation, id int) *Node {
+	node := &Node{sim: sim, id: id, updateRule: sim.UpdateRule}
+	node.pubKey = GetRandomPubKey(sim.Rand)
 	node.seqNo = 0
 	node.subscriptions = []*Node{}
+	node.trust = []float64{}
 	node.state = map[cipher.SHA256]*NodeStateBlockMeta{}
 
 	return node
 }
 
+func (n *Node) GetId() int {
+	return n.id
+}
+
+func (n *Node) GetPubKey() cipher.PubKey {
+	return n.pubKey
+}
+
+func (n *Node) GetSeqNo() int {
+	return n.seqNo
+}
+
+func (n *Node) GetSubscriptions() []*Node {
+	return append([]*Node{}, n.subscriptions...)
+}
+
+// The node's own copy of the meta of the block with the given hash, nil
+// if the block is not in the tree
+func (n *Node) GetState(hash cipher.SHA256) *NodeStateBlockMeta {
+	return n.state[hash]
+}
+
+// The weight the node gives to the block with the given hash
+func (n *Node) GetWeight(hash cipher.SHA256) float64 {
+	if meta, ok := n.state[hash]; ok {
+		return meta.weight
+	}
+	return 0.0
+}
+
+func (n *Node) GetUpdateRule() UpdateRule {
+	return n.updateRule
+}
+
+// Replaces the simulation's update rule for this node only
+func (n *Node) SetUpdateRule(rule UpdateRule) {
+	n.updateRule = rule
+}
+
 func (n *Node) InitializeNode(brt *BlockRecordTree, nodes []*Node, numberOfSubscribers int) {
 	n.InitializeRandomNodeSubcribers(nodes, numberOfSubscribers)
+	n.InitializeTrust()
 	n.InitializeNodeState(brt)
 }
 
@@ -40,11 +87,12 @@ func (n *Node) InitializeRandomNodeSubcribers(nodes []*Node, numberOfSubscribers
 	reuseCheckMap := map[int]bool{}
 
 	for len(n.subscriptions) < numberOfSubscribers {
-		subscriberIndex := rand.Intn(len(nodes))
+		subscriberIndex := n.sim.Rand.Intn(len(nodes))
 
 		if _, ok := reuseCheckMap[subscriberIndex]; !ok && n != nodes[subscriberIndex] {
 			reuseCheckMap[subscriberIndex] = true
 			n.subscriptions = append(n.subscriptions, nodes[subscriberIndex])
+			n.trust = append(n.trust, 1.0)
 		}
 	}
 }
@@ -60,9 +108,9 @@ func (n *Node) InitializeNodeState(brt *BlockRecordTree) {
 
 }
 
-func getRandomSignMultiplier() float64 {
+func getRandomSignMultiplier(rng *rand.Rand) float64 {
 	multiplier := 1.0;
-	if (rand.Intn(2) == 0) {
+	if (rng.Intn(2) == 0) {
 		multiplier = -1.0
 	}
 	return multiplier;
@@ -87,7 +135,7 @@ func (n *Node) ValidateNodeState() error {
 }
 
 func (n *Node) UpdateNodeState() {
-	sim := GetSimulation()
+	sim := n.sim
 	sim.AdvanceTicks()
 	n.seqNo++
 
@@ -98,7 +146,9 @@ func (n *Node) UpdateNodeState() {
 	}
 
 	// Adjust weights towards consensus
-	n.AdjustWeightsTowardsConsensus(GetSimulation().RootBlockTree.Root);
+	n.AdjustWeightsTowardsConsensus(sim.RootBlockTree.Root);
+
+	n.LearnTrust()
 }
 
 func (n *Node) GetMaxSubscribersSeqNo(hash cipher.SHA256) int {
@@ -115,70 +165,70 @@ func (n *Node) GetMaxSubscribersSeqNo(hash cipher.SHA256) int {
 
 func (n *Node) CalculateNewBlockStateMetaWeight(blockRecord *BlockRecord) float64 {
 
+	// Weighted by the trust in each subscription, then blended with the
+	// node's own weight by the simulation's SelfWeight. The same trust and
+	// SelfWeight for every block keep each block's weight the sum of its
+	// children's.
 	totalWeight := 0.0
-	subscriberBlockCount := 0.0
+	totalTrust := 0.0
 
-	for _, subscription := range n.subscriptions {
+	for i, subscription := range n.subscriptions {
 		if _, ok := subscription.state[blockRecord.hash]; ok {
-			totalWeight += subscription.state[blockRecord.hash].weight
-			subscriberBlockCount++
+			totalWeight += n.trust[i] * subscription.state[blockRecord.hash].weight
+			totalTrust += n.trust[i]
 		}
 	}
 
-	var subscriberBlockWeightAvg = 0.0; 
+	var subscriberBlockWeightAvg = 0.0
 
-	if subscriberBlockCount > 0 {
-		subscriberBlockWeightAvg = totalWeight / subscriberBlockCount
+	if totalTrust > 0 {
+		subscriberBlockWeightAvg = totalWeight / totalTrust
 	}
 
-	return subscriberBlockWeightAvg;
+	selfWeight := n.sim.SelfWeight
+	return selfWeight*n.state[blockRecord.hash].weight + (1.0-selfWeight)*subscriberBlockWeightAvg
 }
 
 func (n *Node) PrintNodeDetails() {
+	n.FprintNodeDetails(os.Stdout)
+}
+
+func (n *Node) FprintNodeDetails(w io.Writer) error {
 	subscriptionIds := []int{}
 
 	for _, subscription := range n.subscriptions {
 		subscriptionIds = append(subscriptionIds, subscription.id)
 	}
 
-	fmt.Printf("Node (id=%d seqNo=%d) Details:\n", n.id, n.seqNo)
-	fmt.Printf("PubKey:%v\n", n.pubKey)
-	fmt.Printf("Subscriptions:%v\n", subscriptionIds)
-	fmt.Println("State [Format: blockHash | parentHash | seqNo | ticks | weight]:")
+	fmt.Fprintf(w, "Node (id=%d seqNo=%d) Details:\n", n.id, n.seqNo)
+	fmt.Fprintf(w, "PubKey:%v\n", n.pubKey)
+	fmt.Fprintf(w, "Subscriptions:%v\n", subscriptionIds)
+	if n.sim.Trust.Mode != TRUST_MODE_UNIFORM {
+		fmt.Fprintf(w, "Trust:%.2f\n", n.trust)
+	}
+	fmt.Fprintln(w, "State [Format: blockHash | parentHash | seqNo | ticks | weight]:")
 
 	// Note State Blocks will be printed in the order Breadth first search tree traversal
-	for _, blockRecord := range GetSimulation().RootBlockTree.GetAllBlockRecords() {
+	for _, blockRecord := range n.sim.RootBlockTree.GetAllBlockRecords() {
 		var parentHash cipher.SHA256
 		if blockRecord.parent != nil {
 			parentHash = blockRecord.parent.hash
 		}
-		fmt.Printf("%v | %v | %d | %d | %.2f\n", blockRecord.hash, parentHash, 
-		n.state[blockRecord.hash].seqNo, n.state[blockRecord.hash].ticks, n.state[blockRecord.hash].weight)
+		if _, err := fmt.Fprintf(w, "%v | %v | %d | %d | %.2f\n", blockRecord.hash, parentHash, 
+		n.state[blockRecord.hash].seqNo, n.state[blockRecord.hash].ticks, n.state[blockRecord.hash].weight); err != nil {
+			return err
+		}
 	}
 
+	return nil
 }
 
+// Moves the weights of the children of every block, from root down,
+// towards consensus by the node's update rule
 func (n *Node) AdjustWeightsTowardsConsensus(root *BlockRecord) {
-	totalWeight := n.state[root.hash].weight;
-	runningWeight := totalWeight
+	n.updateRule.AdjustChildren(n, root)
 
 	for _, child := range root.children {
-		
-		if(child == root.children[len(root.children)-1]) {
-			n.state[child.hash].weight = runningWeight;
-		} else if(n.state[child.hash].weight > (totalWeight / float64(len(root.children)))) {
-			n.state[child.hash].weight += CONSENSUS_APPROACH_FACTOR;
-			if(n.state[child.hash].weight > runningWeight) {
-				n.state[child.hash].weight = runningWeight;
-			}
-		} else {
-			n.state[child.hash].weight -= CONSENSUS_APPROACH_FACTOR;
-			if(n.state[child.hash].weight < 0.0) {
-				n.state[child.hash].weight = 0.0;
-			}
-		}
-
-		runningWeight -= n.state[child.hash].weight;
 		n.AdjustWeightsTowardsConsensus(child);
 	}
 }
@@ -196,7 +246,7 @@ func (n *Node) SetWeight(newWeight float64, blockRecord *BlockRecord) {
 			n.SetWeight(runningWeight, child);
 
 		} else if (runningWeight > avgWeight) {
-			assignWeight := avgWeight + getRandomSignMultiplier() * WEIGHT_INIT_FACTOR
+			assignWeight := avgWeight + getRandomSignMultiplier(n.sim.Rand) * n.sim.WeightInitFactor
 			n.SetWeight(assignWeight, child);
 			runningWeight -= assignWeight;
 		} else {
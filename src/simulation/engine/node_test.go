@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+var testSelfWeights = []float64{0.0, 0.3, 0.7, 0.95}
+
+func newTestSimulation(t *testing.T, seed int64, selfWeight float64, trustMode string, updateRule string) *Simulation {
+	sim := NewSimulation(rand.New(rand.NewSource(seed)))
+	sim.Output = &TextOutput{w: io.Discard}
+	sim.SelfWeight = selfWeight
+	sim.Trust.Mode = trustMode
+
+	rule, err := NewUpdateRule(updateRule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.UpdateRule = rule
+
+	if err := sim.InitSimulation(15, 3, 6, 2, 300, false); err != nil {
+		t.Fatal(err)
+	}
+	return sim
+}
+
+// Every block's weight less the sum of its children's, for blocks with
+// children
+func sumErrors(brt *BlockRecordTree, weights map[cipher.SHA256]float64) []float64 {
+	errors := []float64{}
+	for _, block := range brt.GetAllBlockRecords() {
+		if len(block.children) == 0 {
+			continue
+		}
+		childrenSum := 0.0
+		for _, child := range block.children {
+			childrenSum += weights[child.hash]
+		}
+		errors = append(errors, weights[block.hash]-childrenSum)
+	}
+	return errors
+}
+
+func TestCalculateNewBlockStateMetaWeight_SelfWeightBlend(t *testing.T) {
+	for _, selfWeight := range testSelfWeights {
+		sim := newTestSimulation(t, 1, selfWeight, TRUST_MODE_RANDOM, UPDATE_RULE_ADDITIVE)
+		node := sim.Nodes[0]
+
+		for _, block := range sim.RootBlockTree.GetAllBlockRecords() {
+			totalWeight, totalTrust := 0.0, 0.0
+			for i, subscription := range node.subscriptions {
+				totalWeight += node.trust[i] * subscription.GetWeight(block.hash)
+				totalTrust += node.trust[i]
+			}
+			want := selfWeight*node.GetWeight(block.hash) + (1.0-selfWeight)*totalWeight/totalTrust
+
+			if got := node.CalculateNewBlockStateMetaWeight(block); math.Abs(got-want) > 1e-12 {
+				t.Log("SelfWeight", selfWeight, "block", block.hash.Hex(), "got", got, "want", want)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestCalculateNewBlockStateMetaWeight_SelfWeightKeepsSums(t *testing.T) {
+	for _, selfWeight := range testSelfWeights {
+		for seed := int64(1); seed <= 10; seed++ {
+			sim := newTestSimulation(t, seed, selfWeight, TRUST_MODE_RANDOM, UPDATE_RULE_ADDITIVE)
+
+			for _, node := range sim.Nodes {
+				// The blended weights alone, before any update rule:
+				weights := map[cipher.SHA256]float64{}
+				for _, block := range sim.RootBlockTree.GetAllBlockRecords() {
+					weights[block.hash] = node.CalculateNewBlockStateMetaWeight(block)
+				}
+
+				for _, err := range sumErrors(sim.RootBlockTree, weights) {
+					if math.Abs(err) > 1e-9 {
+						t.Log("SelfWeight", selfWeight, "seed", seed, "node", node.id, "parent - sum(children) =", err)
+						t.Fail()
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestUpdateNodeState_SelfWeightPreservesInvariant(t *testing.T) {
+	trustModes := []string{TRUST_MODE_UNIFORM, TRUST_MODE_RANDOM, TRUST_MODE_LEARNED}
+	updateRules := []string{UPDATE_RULE_ADDITIVE, UPDATE_RULE_MULTIPLICATIVE, UPDATE_RULE_MAJORITY_SNAP}
+
+	for _, selfWeight := range testSelfWeights {
+		for _, trustMode := range trustModes {
+			for _, updateRule := range updateRules {
+				for seed := int64(1); seed <= 5; seed++ {
+					sim := newTestSimulation(t, seed, selfWeight, trustMode, updateRule)
+
+					for it := 0; it < sim.Iterations; it++ {
+						node := sim.Nodes[sim.Rand.Intn(len(sim.Nodes))]
+						node.UpdateNodeState()
+
+						if err := node.ValidateNodeState(); err != nil {
+							t.Log("SelfWeight", selfWeight, trustMode, updateRule, "seed", seed, "iteration", it, err)
+							t.Fail()
+							break
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestUpdateNodeState_SelfWeightKeepsRootWeight(t *testing.T) {
+	for _, selfWeight := range testSelfWeights {
+		sim := newTestSimulation(t, 7, selfWeight, TRUST_MODE_LEARNED, UPDATE_RULE_ADDITIVE)
+		root := sim.RootBlockTree.Root.hash
+
+		for it := 0; it < sim.Iterations; it++ {
+			node := sim.Nodes[sim.Rand.Intn(len(sim.Nodes))]
+			node.UpdateNodeState()
+
+			if math.Abs(node.GetWeight(root)-1.0) > 1e-9 {
+				t.Log("SelfWeight", selfWeight, "iteration", it, "node", node.id, "root weight", node.GetWeight(root))
+				t.Fail()
+				break
+			}
+		}
+	}
+}
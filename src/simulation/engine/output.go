@@ -0,0 +1,199 @@
+package engine
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+const OUTPUT_MODE_TEXT = "text"
+const OUTPUT_MODE_JSON = "json"
+const OUTPUT_MODE_CSV = "csv"
+
+// Phases of StateRecord
+const PHASE_INITIAL = "initial"
+const PHASE_UPDATE = "update"
+const PHASE_FINAL = "final"
+
+// Output receives the states of the nodes as the simulation runs
+type Output interface {
+	InitialState(sim *Simulation) error
+	BeforeUpdate(sim *Simulation, node *Node) error
+	AfterUpdate(sim *Simulation, node *Node) error
+	FinalState(sim *Simulation) error
+}
+
+// Returns the Output for the given mode, writing to w
+func NewOutput(mode string, w io.Writer) (Output, error) {
+	switch mode {
+	case OUTPUT_MODE_TEXT:
+		return &TextOutput{w: w}, nil
+	case OUTPUT_MODE_JSON:
+		return &JSONOutput{encoder: json.NewEncoder(w)}, nil
+	case OUTPUT_MODE_CSV:
+		return &CSVOutput{writer: csv.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown output mode %q (must be %s, %s or %s)", mode,
+		OUTPUT_MODE_TEXT, OUTPUT_MODE_JSON, OUTPUT_MODE_CSV)
+}
+
+// One node's state of one block, at one point of the simulation
+type StateRecord struct {
+	Phase      string  `json:"phase"`     // PHASE_INITIAL, PHASE_UPDATE or PHASE_FINAL
+	Iteration  int     `json:"iteration"` // Iterations run so far
+	NodeId     int     `json:"node_id"`
+	BlockHash  string  `json:"block_hash"`
+	ParentHash string  `json:"parent_hash"` // All zeros for the root block
+	SeqNo      int     `json:"seq_no"`
+	Ticks      int     `json:"ticks"`
+	Weight     float64 `json:"weight"`
+}
+
+var stateRecordHeader = []string{"phase", "iteration", "node_id", "block_hash", "parent_hash", "seq_no", "ticks", "weight"}
+
+func (r *StateRecord) csvRow() []string {
+	return []string{r.Phase, strconv.Itoa(r.Iteration), strconv.Itoa(r.NodeId), r.BlockHash, r.ParentHash,
+		strconv.Itoa(r.SeqNo), strconv.Itoa(r.Ticks), strconv.FormatFloat(r.Weight, 'g', -1, 64)}
+}
+
+// Returns the node's state as records, blocks in breadth first order
+func (sim *Simulation) GetStateRecords(phase string, node *Node) []StateRecord {
+	records := []StateRecord{}
+
+	for _, blockRecord := range sim.RootBlockTree.GetAllBlockRecords() {
+		var parentHash cipher.SHA256
+		if blockRecord.parent != nil {
+			parentHash = blockRecord.parent.hash
+		}
+		meta := node.state[blockRecord.hash]
+		records = append(records, StateRecord{
+			Phase:      phase,
+			Iteration:  sim.Iteration,
+			NodeId:     node.id,
+			BlockHash:  blockRecord.hash.Hex(),
+			ParentHash: parentHash.Hex(),
+			SeqNo:      meta.seqNo,
+			Ticks:      meta.ticks,
+			Weight:     meta.weight,
+		})
+	}
+
+	return records
+}
+
+// The human readable layout of PrintAllNodes and PrintNodeDetails. Updates
+// are only shown in verbose mode.
+type TextOutput struct {
+	w io.Writer
+}
+
+func (o *TextOutput) InitialState(sim *Simulation) error {
+	fmt.Fprintf(o.w, "\n\n\n#begin Simulation Initial State:\n")
+	sim.FprintAllNodes(o.w)
+	_, err := fmt.Fprintf(o.w, "\n#end Simulation Initial State\n")
+	return err
+}
+
+func (o *TextOutput) BeforeUpdate(sim *Simulation, node *Node) error {
+	if !sim.VerboseMode {
+		return nil
+	}
+	fmt.Fprintf(o.w, "\n\n\nIteration No. %d", (sim.Iteration + 1))
+	fmt.Fprintf(o.w, "\n\nBefore Update:\n")
+	return node.FprintNodeDetails(o.w)
+}
+
+func (o *TextOutput) AfterUpdate(sim *Simulation, node *Node) error {
+	if !sim.VerboseMode {
+		return nil
+	}
+	fmt.Fprintf(o.w, "\n\nAfter Update:\n")
+	return node.FprintNodeDetails(o.w)
+}
+
+func (o *TextOutput) FinalState(sim *Simulation) error {
+	fmt.Fprintf(o.w, "\n\n\n#begin Simulation Final State:\n")
+	sim.FprintAllNodes(o.w)
+	fmt.Fprintf(o.w, "\n#end Simulation Final State\n")
+
+	if sim.ConvergedIteration != -1 {
+		fmt.Fprintf(o.w, "\nIteration %d: Convergence Achieved!!!\n", sim.ConvergedIteration)
+	}
+
+	summary := sim.SummarizeMetrics()
+	return summary.Fprint(o.w)
+}
+
+// One StateRecord per line as JSON. Every update emits the updated node's
+// state.
+type JSONOutput struct {
+	encoder *json.Encoder
+}
+
+func (o *JSONOutput) write(sim *Simulation, phase string, nodes []*Node) error {
+	for _, node := range nodes {
+		for _, record := range sim.GetStateRecords(phase, node) {
+			if err := o.encoder.Encode(&record); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (o *JSONOutput) InitialState(sim *Simulation) error {
+	return o.write(sim, PHASE_INITIAL, sim.Nodes)
+}
+
+func (o *JSONOutput) BeforeUpdate(sim *Simulation, node *Node) error {
+	return nil
+}
+
+func (o *JSONOutput) AfterUpdate(sim *Simulation, node *Node) error {
+	return o.write(sim, PHASE_UPDATE, []*Node{node})
+}
+
+func (o *JSONOutput) FinalState(sim *Simulation) error {
+	return o.write(sim, PHASE_FINAL, sim.Nodes)
+}
+
+// One StateRecord per row as CSV, after a header row. Every update emits
+// the updated node's state.
+type CSVOutput struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func (o *CSVOutput) write(sim *Simulation, phase string, nodes []*Node) error {
+	if !o.headerWritten {
+		o.writer.Write(stateRecordHeader)
+		o.headerWritten = true
+	}
+	for _, node := range nodes {
+		for _, record := range sim.GetStateRecords(phase, node) {
+			o.writer.Write(record.csvRow())
+		}
+	}
+	o.writer.Flush()
+	return o.writer.Error()
+}
+
+func (o *CSVOutput) InitialState(sim *Simulation) error {
+	return o.write(sim, PHASE_INITIAL, sim.Nodes)
+}
+
+func (o *CSVOutput) BeforeUpdate(sim *Simulation, node *Node) error {
+	return nil
+}
+
+func (o *CSVOutput) AfterUpdate(sim *Simulation, node *Node) error {
+	return o.write(sim, PHASE_UPDATE, []*Node{node})
+}
+
+func (o *CSVOutput) FinalState(sim *Simulation) error {
+	return o.write(sim, PHASE_FINAL, sim.Nodes)
+}
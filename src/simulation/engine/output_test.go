@@ -0,0 +1,172 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// Runs a simulation writing to a buffer in the given mode
+func runSimulationWithOutput(t *testing.T, mode string) (*Simulation, []byte) {
+	var buf bytes.Buffer
+	sim := newTestSimulation(t, 3, 0.0, TRUST_MODE_UNIFORM, UPDATE_RULE_ADDITIVE)
+
+	output, err := NewOutput(mode, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.Output = output
+	if err := sim.RunSimulation(); err != nil {
+		t.Fatal(err)
+	}
+	return sim, buf.Bytes()
+}
+
+// Checks the records are the initial state of every node, one update per
+// iteration and the final state of every node, each a whole tree in breadth
+// first order, and that the final weights are the nodes' weights
+func checkStateRecords(t *testing.T, sim *Simulation, records []StateRecord) {
+	blocks := sim.RootBlockTree.GetAllBlockRecords()
+	nodes := len(sim.Nodes)
+
+	if sim.Iteration == 0 {
+		t.Fatal("The simulation ran no updates")
+	}
+	if want := (2*nodes + sim.Iteration) * len(blocks); len(records) != want {
+		t.Fatal("Got", len(records), "records, want", want)
+	}
+
+	for i, record := range records {
+		tree, block := i/len(blocks), blocks[i%len(blocks)]
+
+		phase, iteration := PHASE_UPDATE, tree-nodes+1
+		if tree < nodes {
+			phase, iteration = PHASE_INITIAL, 0
+		} else if tree >= nodes+sim.Iteration {
+			phase, iteration = PHASE_FINAL, sim.Iteration
+		}
+
+		parentHash := "0000000000000000000000000000000000000000000000000000000000000000"
+		if block.parent != nil {
+			parentHash = block.parent.hash.Hex()
+		}
+
+		if record.Phase != phase || record.Iteration != iteration || record.BlockHash != block.hash.Hex() ||
+			record.ParentHash != parentHash {
+			t.Log("Record", i, "is", record, "want phase", phase, "iteration", iteration, "block", block.hash.Hex())
+			t.Fail()
+		}
+
+		if phase == PHASE_FINAL {
+			node := sim.Nodes[tree-nodes-sim.Iteration]
+			if record.NodeId != node.id || record.Weight != node.GetWeight(block.hash) {
+				t.Log("Final record", i, "is", record, "want node", node.id, "weight", node.GetWeight(block.hash))
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestNewOutput_UnknownMode(t *testing.T) {
+	if output, err := NewOutput("xml", &bytes.Buffer{}); err == nil || output != nil {
+		t.Log("NewOutput accepted an unknown mode")
+		t.Fail()
+	}
+
+	for _, mode := range []string{OUTPUT_MODE_TEXT, OUTPUT_MODE_JSON, OUTPUT_MODE_CSV} {
+		if _, err := NewOutput(mode, &bytes.Buffer{}); err != nil {
+			t.Log("NewOutput rejected mode", mode, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestJSONOutput_StateRecords(t *testing.T) {
+	sim, output := runSimulationWithOutput(t, OUTPUT_MODE_JSON)
+
+	records := []StateRecord{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		// Every line is one record with exactly the fields of the header:
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(scanner.Bytes(), &fields); err != nil {
+			t.Fatal(err)
+		}
+		if len(fields) != len(stateRecordHeader) {
+			t.Fatal("Line has fields", fields, "want", stateRecordHeader)
+		}
+		for _, name := range stateRecordHeader {
+			if _, ok := fields[name]; !ok {
+				t.Fatal("Line has no field", name)
+			}
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		decoder.DisallowUnknownFields()
+		var record StateRecord
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkStateRecords(t, sim, records)
+}
+
+func TestCSVOutput_StateRecords(t *testing.T) {
+	sim, output := runSimulationWithOutput(t, OUTPUT_MODE_CSV)
+
+	rows, err := csv.NewReader(bytes.NewReader(output)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) == 0 || !reflect.DeepEqual(rows[0], stateRecordHeader) {
+		t.Fatal("CSV does not start with the header", stateRecordHeader)
+	}
+
+	records := []StateRecord{}
+	for _, row := range rows[1:] {
+		iteration, err1 := strconv.Atoi(row[1])
+		nodeId, err2 := strconv.Atoi(row[2])
+		seqNo, err3 := strconv.Atoi(row[5])
+		ticks, err4 := strconv.Atoi(row[6])
+		weight, err5 := strconv.ParseFloat(row[7], 64)
+		for _, err := range []error{err1, err2, err3, err4, err5} {
+			if err != nil {
+				t.Fatal("Row", row, err)
+			}
+		}
+		records = append(records, StateRecord{Phase: row[0], Iteration: iteration, NodeId: nodeId, BlockHash: row[3],
+			ParentHash: row[4], SeqNo: seqNo, Ticks: ticks, Weight: weight})
+	}
+
+	checkStateRecords(t, sim, records)
+}
+
+// The header names the JSON fields of StateRecord, in order
+func TestStateRecord_HeaderMatchesSchema(t *testing.T) {
+	recordType := reflect.TypeOf(StateRecord{})
+	if recordType.NumField() != len(stateRecordHeader) {
+		t.Fatal("StateRecord has", recordType.NumField(), "fields, the header", len(stateRecordHeader))
+	}
+	for i, name := range stateRecordHeader {
+		if tag := recordType.Field(i).Tag.Get("json"); tag != name {
+			t.Log("Field", i, "has JSON name", tag, "the header", name)
+			t.Fail()
+		}
+	}
+
+	record := StateRecord{Phase: PHASE_UPDATE, Iteration: 1, NodeId: 2, BlockHash: "a", ParentHash: "b", SeqNo: 3, Ticks: 4,
+		Weight: 0.25}
+	if row := record.csvRow(); !reflect.DeepEqual(row, []string{"update", "1", "2", "a", "b", "3", "4", "0.25"}) {
+		t.Log("csvRow is", row)
+		t.Fail()
+	}
+}
@@ -0,0 +1,149 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+)
+
+type Simulation struct {
+	Rand               *rand.Rand // The only source of randomness of the simulation
+	Output             Output     // Where the states go as the simulation runs
+	Convergence        ConvergenceCriterion
+	ApproachFactor     float64 // How far a node moves a child's weight towards consensus per update
+	UpdateRule         UpdateRule // How the nodes move their weights towards consensus, unless a node's is replaced
+	WeightInitFactor   float64    // The spread of the initial weights around an even split
+	Trust              TrustModel // How the nodes weigh their subscriptions when averaging
+	SelfWeight         float64    // The share of a node's own weight, in [0, 1), in its new weight; the rest is the subscriber average
+	VerboseMode        bool
+	Iterations         int
+	Iteration          int // Iterations run so far
+	ConvergedIteration int // Iteration at which convergence was achieved and then held for the window, -1 if not (yet)
+	convergedStreak    int // Consecutive iterations convergence has held for
+	Metrics            []IterationMetrics // After InitSimulation, then after every Step
+	Ticks              int
+	Nodes              []*Node
+	RootBlockTree      *BlockRecordTree
+}
+
+// The same seeded rng reproduces the same run. The states are printed to
+// stdout as text, until Output is replaced. The nodes use the additive
+// update rule, until UpdateRule is replaced before InitSimulation.
+func NewSimulation(rng *rand.Rand) *Simulation {
+	return &Simulation{Rand: rng, Output: &TextOutput{w: os.Stdout}, Convergence: DefaultConvergenceCriterion(),
+		ApproachFactor: CONSENSUS_APPROACH_FACTOR, UpdateRule: &AdditiveUpdateRule{}, WeightInitFactor: WEIGHT_INIT_FACTOR,
+		Trust: DefaultTrustModel()}
+}
+
+func (sim *Simulation) InitSimulation(totalRootBlockTreeNodes int, totalRootBlockTreeChildrenPerNode int, numberOfNodes int,
+	numberOfSubscribers int, iterations int, verboseMode bool) error {
+	if rootBlockTree, err := NewRandomBlockRecordTree(sim.Rand, totalRootBlockTreeNodes, totalRootBlockTreeChildrenPerNode); err != nil {
+		return err
+	} else {
+		sim.RootBlockTree = rootBlockTree
+	}
+
+	sim.Nodes = []*Node{}
+	for i := 0; i < numberOfNodes; i++ {
+		node := NewRandomNode(sim, i+1)
+		sim.Nodes = append(sim.Nodes, node)
+	}
+
+	for _, node := range sim.Nodes {
+		node.InitializeNode(sim.RootBlockTree, sim.Nodes, numberOfSubscribers)
+	}
+
+	sim.Ticks = 0
+	sim.Iterations = iterations
+	sim.Iteration = 0
+	sim.ConvergedIteration = -1
+	sim.convergedStreak = 0
+	sim.Metrics = []IterationMetrics{sim.ComputeMetrics()}
+	sim.VerboseMode = verboseMode
+
+	return nil
+}
+
+func (sim *Simulation) AdvanceTicks() {
+	sim.Ticks++
+}
+
+// Runs one iteration: updates the state of one node picked at random,
+// validates it and checks for convergence. Returns the updated node.
+func (sim *Simulation) Step() (*Node, error) {
+	it := sim.Iteration
+
+	node := sim.Nodes[sim.Rand.Intn(len(sim.Nodes))]
+
+	if err := sim.Output.BeforeUpdate(sim, node); err != nil {
+		return node, err
+	}
+
+	node.UpdateNodeState()
+
+	if err := node.ValidateNodeState(); err != nil {
+		return node, fmt.Errorf("Node State Validation failed for node-id:%d Iteration:%d err:%s", node.id, it, err.Error())
+	}
+
+	sim.Iteration++
+	sim.Metrics = append(sim.Metrics, sim.ComputeMetrics())
+
+	if err := sim.Output.AfterUpdate(sim, node); err != nil {
+		return node, err
+	}
+	if sim.ConvergedIteration == -1 {
+		sim.observeConvergence(it, sim.CheckConvergence())
+	}
+
+	return node, nil
+}
+
+// Counts the consecutive iterations convergence held for, and sets
+// ConvergedIteration once it held for the window
+func (sim *Simulation) observeConvergence(it int, converged bool) {
+	if converged {
+		sim.convergedStreak++
+	} else {
+		sim.convergedStreak = 0
+	}
+	window := sim.Convergence.Window
+	if window < 1 {
+		window = 1
+	}
+	if sim.convergedStreak >= window {
+		// The iteration from which it held:
+		sim.ConvergedIteration = it - window + 1
+	}
+}
+
+// Steps until convergence or until all iterations are done, writing the
+// initial and final states to Output.
+func (sim *Simulation) RunSimulation() error {
+
+	if err := sim.Output.InitialState(sim); err != nil {
+		return err
+	}
+
+	for sim.Iteration < sim.Iterations && sim.ConvergedIteration == -1 {
+		if _, err := sim.Step(); err != nil {
+			return err
+		}
+	}
+
+	sim.Ticks++
+
+	return sim.Output.FinalState(sim)
+}
+
+func (sim *Simulation) PrintAllNodes() {
+	sim.FprintAllNodes(os.Stdout)
+}
+
+func (sim *Simulation) FprintAllNodes(w io.Writer) {
+
+	for _, node := range sim.Nodes {
+		fmt.Fprintf(w, "\n")
+		node.FprintNodeDetails(w)
+	}
+}
@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"bytes"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// Runs a verbose simulation with the given seed and returns its text output
+func runSimulationToBuffer(seed int64) ([]byte, error) {
+	output, _, err := runSimulationInMode(seed, OUTPUT_MODE_TEXT)
+	return output, err
+}
+
+// Runs a verbose simulation with the given seed and returns its output in
+// the given mode, and for the JSON and CSV modes its metrics in that mode
+func runSimulationInMode(seed int64, mode string) ([]byte, []byte, error) {
+	var buf bytes.Buffer
+	output, err := NewOutput(mode, &buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	sim := NewSimulation(rand.New(rand.NewSource(seed)))
+	sim.Output = output
+	sim.Trust.Mode = TRUST_MODE_LEARNED
+
+	if err := sim.InitSimulation(15, 3, 6, 2, 300, true); err != nil {
+		return nil, nil, err
+	}
+	if err := sim.RunSimulation(); err != nil {
+		return nil, nil, err
+	}
+
+	var metrics bytes.Buffer
+	if mode != OUTPUT_MODE_TEXT {
+		if err := sim.WriteMetrics(mode, &metrics); err != nil {
+			return nil, nil, err
+		}
+	}
+	return buf.Bytes(), metrics.Bytes(), nil
+}
+
+// Simulations share no state, so running them at once gives what running
+// them one by one does; run with -race to check
+func TestSimulation_Concurrent(t *testing.T) {
+	const count = 8
+
+	sequential := make([][]byte, count)
+	for i := 0; i < count; i++ {
+		output, err := runSimulationToBuffer(int64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sequential[i] = output
+	}
+
+	concurrent := make([][]byte, count)
+	errs := make([]error, count)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			concurrent[i], errs[i] = runSimulationToBuffer(int64(i))
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < count; i++ {
+		if errs[i] != nil {
+			t.Log("Seed", i, errs[i])
+			t.Fail()
+		} else if !bytes.Equal(concurrent[i], sequential[i]) {
+			t.Log("Seed", i, "gave different output when run concurrently")
+			t.Fail()
+		}
+	}
+}
+
+func TestRunSimulation_SameSeedSameOutput(t *testing.T) {
+	for _, mode := range []string{OUTPUT_MODE_TEXT, OUTPUT_MODE_JSON, OUTPUT_MODE_CSV} {
+		for seed := int64(1); seed <= 5; seed++ {
+			first, firstMetrics, err := runSimulationInMode(seed, mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, secondMetrics, err := runSimulationInMode(seed, mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(first) == 0 || !bytes.Equal(first, second) {
+				t.Log("Seed", seed, "gave different", mode, "output on a second run")
+				t.Fail()
+			}
+			if mode != OUTPUT_MODE_TEXT && (len(firstMetrics) == 0 || !bytes.Equal(firstMetrics, secondMetrics)) {
+				t.Log("Seed", seed, "gave different", mode, "metrics on a second run")
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestRunSimulation_DifferentSeedsDifferentOutput(t *testing.T) {
+	outputs := map[string]int64{}
+	for seed := int64(1); seed <= 5; seed++ {
+		output, err := runSimulationToBuffer(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if other, ok := outputs[string(output)]; ok {
+			t.Log("Seeds", other, "and", seed, "gave the same output")
+			t.Fail()
+		}
+		outputs[string(output)] = seed
+	}
+}
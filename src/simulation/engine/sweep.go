@@ -0,0 +1,237 @@
+package engine
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+)
+
+// One configuration of a parameter sweep
+type SweepConfig struct {
+	Nodes            int     `json:"nodes"`
+	Subscribers      int     `json:"subscribers"`
+	BlockRecordCount int     `json:"block_record_count"`
+	ChildrenPerBlock int     `json:"children_per_block"`
+	ApproachFactor   float64 `json:"approach_factor"`
+	UpdateRule       string  `json:"update_rule"`
+	WeightInitFactor float64 `json:"weight_init_factor"`
+	SelfWeight       float64 `json:"self_weight"`
+}
+
+// Every combination of the given values, varying the self weight fastest
+// and the number of nodes slowest
+func SweepConfigs(nodes []int, subscribers []int, blockRecordCounts []int, childrenPerBlock []int,
+	approachFactors []float64, updateRules []string, weightInitFactors []float64, selfWeights []float64) []SweepConfig {
+	configs := []SweepConfig{}
+
+	for _, nodeCount := range nodes {
+		for _, subscriberCount := range subscribers {
+			for _, blockRecordCount := range blockRecordCounts {
+				for _, childrenCount := range childrenPerBlock {
+					for _, approachFactor := range approachFactors {
+						for _, updateRule := range updateRules {
+							for _, weightInitFactor := range weightInitFactors {
+								for _, selfWeight := range selfWeights {
+									configs = append(configs, SweepConfig{Nodes: nodeCount, Subscribers: subscriberCount,
+										BlockRecordCount: blockRecordCount, ChildrenPerBlock: childrenCount,
+										ApproachFactor: approachFactor, UpdateRule: updateRule, WeightInitFactor: weightInitFactor,
+										SelfWeight: selfWeight})
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return configs
+}
+
+// The outcome of one simulation of a sweep
+type SweepRun struct {
+	Config             SweepConfig
+	Seed               int64
+	Iterations         int // Iterations run
+	ConvergedIteration int // -1 if not converged
+	Err                error
+}
+
+// Runs one simulation of the configuration with the given seed, without
+// writing its states anywhere
+func RunSweepConfig(config SweepConfig, seed int64, iterations int, convergence ConvergenceCriterion,
+	trust TrustModel) SweepRun {
+	run := SweepRun{Config: config, Seed: seed, ConvergedIteration: -1}
+
+	sim := NewSimulation(rand.New(rand.NewSource(seed)))
+	sim.Output = &TextOutput{w: io.Discard}
+	sim.Convergence = convergence
+	sim.Trust = trust
+	sim.ApproachFactor = config.ApproachFactor
+	sim.WeightInitFactor = config.WeightInitFactor
+	sim.SelfWeight = config.SelfWeight
+	if sim.UpdateRule, run.Err = NewUpdateRule(config.UpdateRule); run.Err != nil {
+		return run
+	}
+
+	if run.Err = sim.InitSimulation(config.BlockRecordCount, config.ChildrenPerBlock, config.Nodes, config.Subscribers,
+		iterations, false); run.Err != nil {
+		return run
+	}
+	run.Err = sim.RunSimulation()
+	run.Iterations = sim.Iteration
+	run.ConvergedIteration = sim.ConvergedIteration
+
+	return run
+}
+
+// Runs every configuration once per seed, at most parallel simulations at
+// once. Every simulation has its own RNG, so the runs are the same however
+// many run in parallel. The runs are returned in order: by configuration,
+// then by seed.
+func RunSweep(configs []SweepConfig, seeds []int64, iterations int, convergence ConvergenceCriterion,
+	trust TrustModel, parallel int) []SweepRun {
+	runs := make([]SweepRun, len(configs)*len(seeds))
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				runs[i] = RunSweepConfig(configs[i/len(seeds)], seeds[i%len(seeds)], iterations, convergence, trust)
+			}
+		}()
+	}
+
+	for i := range runs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return runs
+}
+
+// The runs of one configuration, summarized. Iterations to convergence is
+// ConvergedIteration + 1, the number of updates until convergence first
+// held; the mean, min and max are over the converged runs, -1 if none.
+type SweepSummary struct {
+	SweepConfig
+	Runs                        int     `json:"runs"`
+	Converged                   int     `json:"converged"`
+	Failed                      int     `json:"failed"` // Runs that stopped with an error
+	ConvergenceRate             float64 `json:"convergence_rate"`
+	MeanIterationsToConvergence float64 `json:"mean_iterations_to_convergence"`
+	MinIterationsToConvergence  int     `json:"min_iterations_to_convergence"`
+	MaxIterationsToConvergence  int     `json:"max_iterations_to_convergence"`
+}
+
+var sweepSummaryHeader = []string{"nodes", "subscribers", "block_record_count", "children_per_block", "approach_factor",
+	"update_rule", "weight_init_factor", "self_weight", "runs", "converged", "failed", "convergence_rate", "mean_iterations_to_convergence",
+	"min_iterations_to_convergence", "max_iterations_to_convergence"}
+
+func (s *SweepSummary) csvRow() []string {
+	f := func(x float64) string { return strconv.FormatFloat(x, 'g', -1, 64) }
+	return []string{strconv.Itoa(s.Nodes), strconv.Itoa(s.Subscribers), strconv.Itoa(s.BlockRecordCount),
+		strconv.Itoa(s.ChildrenPerBlock), f(s.ApproachFactor), s.UpdateRule, f(s.WeightInitFactor), f(s.SelfWeight),
+		strconv.Itoa(s.Runs), strconv.Itoa(s.Converged), strconv.Itoa(s.Failed), f(s.ConvergenceRate),
+		f(s.MeanIterationsToConvergence),
+		strconv.Itoa(s.MinIterationsToConvergence), strconv.Itoa(s.MaxIterationsToConvergence)}
+}
+
+// Summarizes the runs per configuration, in the order the configurations
+// first appear
+func SummarizeSweep(runs []SweepRun) []SweepSummary {
+	summaries := []SweepSummary{}
+	index := map[SweepConfig]int{}
+
+	for _, run := range runs {
+		i, ok := index[run.Config]
+		if !ok {
+			i = len(summaries)
+			index[run.Config] = i
+			summaries = append(summaries, SweepSummary{SweepConfig: run.Config, MeanIterationsToConvergence: -1,
+				MinIterationsToConvergence: -1, MaxIterationsToConvergence: -1})
+		}
+		s := &summaries[i]
+
+		s.Runs++
+		if run.Err != nil {
+			s.Failed++
+			continue
+		}
+		if run.ConvergedIteration == -1 {
+			continue
+		}
+
+		iterations := run.ConvergedIteration + 1
+		if s.Converged == 0 {
+			s.MeanIterationsToConvergence = 0.0
+			s.MinIterationsToConvergence = iterations
+			s.MaxIterationsToConvergence = iterations
+		}
+		s.Converged++
+		// Summed here, divided below:
+		s.MeanIterationsToConvergence += float64(iterations)
+		if iterations < s.MinIterationsToConvergence {
+			s.MinIterationsToConvergence = iterations
+		}
+		if iterations > s.MaxIterationsToConvergence {
+			s.MaxIterationsToConvergence = iterations
+		}
+	}
+
+	for i := range summaries {
+		s := &summaries[i]
+		s.ConvergenceRate = float64(s.Converged) / float64(s.Runs)
+		if s.Converged > 0 {
+			s.MeanIterationsToConvergence /= float64(s.Converged)
+		}
+	}
+
+	return summaries
+}
+
+// Writes the summaries as an aligned text table, as JSON lines, or as CSV
+// with a header row
+func WriteSweepSummaries(mode string, w io.Writer, summaries []SweepSummary) error {
+	switch mode {
+	case OUTPUT_MODE_TEXT:
+		writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(writer, "nodes\tsubscribers\tblocks\tchildren\tapproach\trule\tinit\tself\truns\tconverged\tfailed\trate\tmean iters\tmin iters\tmax iters\t")
+		for _, s := range summaries {
+			fmt.Fprintf(writer, "%d\t%d\t%d\t%d\t%g\t%s\t%g\t%g\t%d\t%d\t%d\t%.2f\t%.1f\t%d\t%d\t\n", s.Nodes, s.Subscribers,
+				s.BlockRecordCount, s.ChildrenPerBlock, s.ApproachFactor, s.UpdateRule, s.WeightInitFactor, s.SelfWeight, s.Runs, s.Converged, s.Failed,
+				s.ConvergenceRate, s.MeanIterationsToConvergence, s.MinIterationsToConvergence, s.MaxIterationsToConvergence)
+		}
+		return writer.Flush()
+	case OUTPUT_MODE_JSON:
+		encoder := json.NewEncoder(w)
+		for _, summary := range summaries {
+			if err := encoder.Encode(&summary); err != nil {
+				return err
+			}
+		}
+		return nil
+	case OUTPUT_MODE_CSV:
+		writer := csv.NewWriter(w)
+		writer.Write(sweepSummaryHeader)
+		for _, summary := range summaries {
+			writer.Write(summary.csvRow())
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return fmt.Errorf("unknown output mode %q (must be %s, %s or %s)", mode,
+		OUTPUT_MODE_TEXT, OUTPUT_MODE_JSON, OUTPUT_MODE_CSV)
+}
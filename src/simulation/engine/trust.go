@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+)
+
+// Every subscription is trusted the same, a uniform average
+const TRUST_MODE_UNIFORM = "uniform"
+
+// Every subscription is trusted at random when the topology is built, and
+// the trust stays
+const TRUST_MODE_RANDOM = "random"
+
+// Every subscription starts trusted the same; after every update the node
+// moves its trust in a subscription towards how much they agree
+const TRUST_MODE_LEARNED = "learned"
+
+// The lowest trust, so that no subscription drops out of the average
+const MIN_SUBSCRIPTION_TRUST = 0.01
+
+type TrustModel struct {
+	Mode string // TRUST_MODE_UNIFORM, TRUST_MODE_RANDOM or TRUST_MODE_LEARNED
+
+	// In TRUST_MODE_LEARNED, how far the trust moves towards the latest
+	// agreement per update, in (0, 1]
+	LearningRate float64
+}
+
+// The uniform average
+func DefaultTrustModel() TrustModel {
+	return TrustModel{Mode: TRUST_MODE_UNIFORM, LearningRate: 0.1}
+}
+
+func (t *TrustModel) Validate() error {
+	if t.Mode != TRUST_MODE_UNIFORM && t.Mode != TRUST_MODE_RANDOM && t.Mode != TRUST_MODE_LEARNED {
+		return fmt.Errorf("unknown trust mode %q (must be %s, %s or %s)", t.Mode,
+			TRUST_MODE_UNIFORM, TRUST_MODE_RANDOM, TRUST_MODE_LEARNED)
+	}
+	if t.LearningRate <= 0.0 || t.LearningRate > 1.0 {
+		return fmt.Errorf("trust learning rate must be in (0, 1], got %v", t.LearningRate)
+	}
+	return nil
+}
+
+// The node's trust in each of its subscriptions, in the order of
+// GetSubscriptions
+func (n *Node) GetSubscriptionTrust() []float64 {
+	return append([]float64{}, n.trust...)
+}
+
+// Sets the node's trust in one of its subscriptions. The trust must be at
+// least MIN_SUBSCRIPTION_TRUST; in TRUST_MODE_LEARNED it is where the
+// learning starts from.
+func (n *Node) SetSubscriptionTrust(subscription *Node, trust float64) error {
+	if trust < MIN_SUBSCRIPTION_TRUST || math.IsInf(trust, 0) || math.IsNaN(trust) {
+		return fmt.Errorf("trust must be a number of at least %v, got %v", MIN_SUBSCRIPTION_TRUST, trust)
+	}
+	for i, s := range n.subscriptions {
+		if s == subscription {
+			n.trust[i] = trust
+			return nil
+		}
+	}
+	return fmt.Errorf("node %d is not subscribed to node %d", n.id, subscription.id)
+}
+
+// Draws the trust in every subscription in TRUST_MODE_RANDOM, uniform in
+// [MIN_SUBSCRIPTION_TRUST, 1)
+func (n *Node) InitializeTrust() {
+	if n.sim.Trust.Mode != TRUST_MODE_RANDOM {
+		return
+	}
+	for i := range n.trust {
+		n.trust[i] = MIN_SUBSCRIPTION_TRUST + n.sim.Rand.Float64()*(1.0-MIN_SUBSCRIPTION_TRUST)
+	}
+}
+
+// How much the node agrees with the subscription: 1 less the mean
+// difference of their weights over all blocks
+func (n *Node) GetAgreement(subscription *Node) float64 {
+	// In tree order, not map order, so the sum is the same every run:
+	allBlocks := n.sim.RootBlockTree.GetAllBlockRecords()
+
+	difference := 0.0
+	for _, block := range allBlocks {
+		difference += math.Abs(n.GetWeight(block.hash) - subscription.GetWeight(block.hash))
+	}
+	return math.Max(1.0-difference/float64(len(allBlocks)), 0.0)
+}
+
+// Moves the trust in every subscription towards how much the node agrees
+// with it now, in TRUST_MODE_LEARNED
+func (n *Node) LearnTrust() {
+	if n.sim.Trust.Mode != TRUST_MODE_LEARNED {
+		return
+	}
+	rate := n.sim.Trust.LearningRate
+	for i, subscription := range n.subscriptions {
+		trust := (1.0-rate)*n.trust[i] + rate*n.GetAgreement(subscription)
+		n.trust[i] = math.Max(trust, MIN_SUBSCRIPTION_TRUST)
+	}
+}
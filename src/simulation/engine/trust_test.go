@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestTrust_UniformIsPlainAverage(t *testing.T) {
+	sim := newTestSimulation(t, 2, 0.0, TRUST_MODE_UNIFORM, UPDATE_RULE_ADDITIVE)
+
+	for _, node := range sim.Nodes {
+		for _, trust := range node.GetSubscriptionTrust() {
+			if trust != 1.0 {
+				t.Fatal("Node", node.id, "has uniform trust", node.GetSubscriptionTrust())
+			}
+		}
+
+		for _, block := range sim.RootBlockTree.GetAllBlockRecords() {
+			sum := 0.0
+			for _, subscription := range node.GetSubscriptions() {
+				sum += subscription.GetWeight(block.hash)
+			}
+			want := sum / float64(len(node.GetSubscriptions()))
+
+			if got := node.CalculateNewBlockStateMetaWeight(block); math.Abs(got-want) > 1e-12 {
+				t.Log("Node", node.id, "block", block.hash.Hex(), "got", got, "want the average", want)
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestTrust_RandomIsSeeded(t *testing.T) {
+	trustOf := func(seed int64) [][]float64 {
+		sim := newTestSimulation(t, seed, 0.0, TRUST_MODE_RANDOM, UPDATE_RULE_ADDITIVE)
+		trusts := [][]float64{}
+		for _, node := range sim.Nodes {
+			for _, trust := range node.GetSubscriptionTrust() {
+				if trust < MIN_SUBSCRIPTION_TRUST || trust >= 1.0 {
+					t.Fatal("Seed", seed, "node", node.id, "has trust", trust)
+				}
+			}
+			trusts = append(trusts, node.GetSubscriptionTrust())
+		}
+		return trusts
+	}
+
+	first := trustOf(4)
+	if !reflect.DeepEqual(first, trustOf(4)) {
+		t.Log("The same seed drew different trust")
+		t.Fail()
+	}
+	if reflect.DeepEqual(first, trustOf(5)) {
+		t.Log("Different seeds drew the same trust")
+		t.Fail()
+	}
+}
+
+func TestTrust_LearnedMovesTowardsAgreement(t *testing.T) {
+	// Node 1 agrees with node 2 on every block, and disagrees with node 3
+	// on both leaves:
+	sim := newFixtureSimulation(t, [][3]float64{{1, 1, 0}, {1, 1, 0}, {1, 0, 1}})
+	sim.Trust = TrustModel{Mode: TRUST_MODE_LEARNED, LearningRate: 0.5}
+	node, agreeing, disagreeing := sim.Nodes[0], sim.Nodes[1], sim.Nodes[2]
+
+	node.subscriptions = []*Node{agreeing, disagreeing}
+	node.trust = []float64{1.0, 1.0}
+	for _, subscription := range node.subscriptions {
+		if err := node.SetSubscriptionTrust(subscription, 0.5); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if a, d := node.GetAgreement(agreeing), node.GetAgreement(disagreeing); a != 1.0 || math.Abs(d-1.0/3.0) > 1e-12 {
+		t.Fatal("Agreements are", a, d, "want 1 and 1/3")
+	}
+
+	node.LearnTrust()
+	trust := node.GetSubscriptionTrust()
+	if trust[0] != 0.75 || math.Abs(trust[1]-(0.25+1.0/6.0)) > 1e-12 {
+		t.Log("Learned trust is", trust, "want half way to 1 and to 1/3")
+		t.Fail()
+	}
+
+	for i := 0; i < 100; i++ {
+		node.LearnTrust()
+	}
+	trust = node.GetSubscriptionTrust()
+	if math.Abs(trust[0]-1.0) > 1e-9 || math.Abs(trust[1]-1.0/3.0) > 1e-9 {
+		t.Log("Learned trust settled at", trust, "want 1 and 1/3")
+		t.Fail()
+	}
+
+	// Only in TRUST_MODE_LEARNED:
+	sim.Trust.Mode = TRUST_MODE_RANDOM
+	node.SetSubscriptionTrust(agreeing, 0.5)
+	node.LearnTrust()
+	if node.GetSubscriptionTrust()[0] != 0.5 {
+		t.Log("Trust was learned in", sim.Trust.Mode, "mode")
+		t.Fail()
+	}
+}
+
+func TestSetSubscriptionTrust_Rejects(t *testing.T) {
+	sim := newTestSimulation(t, 2, 0.0, TRUST_MODE_UNIFORM, UPDATE_RULE_ADDITIVE)
+	node := sim.Nodes[0]
+	subscription := node.GetSubscriptions()[0]
+
+	for _, trust := range []float64{0.0, MIN_SUBSCRIPTION_TRUST / 2, math.NaN(), math.Inf(1)} {
+		if err := node.SetSubscriptionTrust(subscription, trust); err == nil {
+			t.Log("SetSubscriptionTrust accepted", trust)
+			t.Fail()
+		}
+	}
+	if err := node.SetSubscriptionTrust(node, 0.5); err == nil {
+		t.Log("SetSubscriptionTrust accepted a node that is not a subscription")
+		t.Fail()
+	}
+}
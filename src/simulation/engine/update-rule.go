@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+)
+
+const UPDATE_RULE_ADDITIVE = "additive"
+const UPDATE_RULE_MULTIPLICATIVE = "multiplicative"
+const UPDATE_RULE_MAJORITY_SNAP = "majority-snap"
+
+// How a node moves its weights towards consensus, after averaging the
+// weights of its subscriptions. The strength of every rule is the
+// simulation's ApproachFactor.
+type UpdateRule interface {
+	Name() string
+
+	// Moves the weights of the block's children, keeping their sum the
+	// weight of the block
+	AdjustChildren(n *Node, block *BlockRecord)
+}
+
+// Returns the UpdateRule of the given name
+func NewUpdateRule(name string) (UpdateRule, error) {
+	switch name {
+	case UPDATE_RULE_ADDITIVE:
+		return &AdditiveUpdateRule{}, nil
+	case UPDATE_RULE_MULTIPLICATIVE:
+		return &MultiplicativeUpdateRule{}, nil
+	case UPDATE_RULE_MAJORITY_SNAP:
+		return &MajoritySnapUpdateRule{}, nil
+	}
+	return nil, fmt.Errorf("unknown update rule %q (must be %s, %s or %s)", name,
+		UPDATE_RULE_ADDITIVE, UPDATE_RULE_MULTIPLICATIVE, UPDATE_RULE_MAJORITY_SNAP)
+}
+
+// Moves every child but the last a fixed step of ApproachFactor: up if it
+// has more than an even share of the block's weight, else down. The last
+// child gets the rest.
+type AdditiveUpdateRule struct{}
+
+func (r *AdditiveUpdateRule) Name() string {
+	return UPDATE_RULE_ADDITIVE
+}
+
+func (r *AdditiveUpdateRule) AdjustChildren(n *Node, block *BlockRecord) {
+	totalWeight := n.state[block.hash].weight
+	runningWeight := totalWeight
+
+	for _, child := range block.children {
+		if child == block.children[len(block.children)-1] {
+			n.state[child.hash].weight = runningWeight
+		} else if n.state[child.hash].weight > (totalWeight / float64(len(block.children))) {
+			n.state[child.hash].weight += n.sim.ApproachFactor
+			if n.state[child.hash].weight > runningWeight {
+				n.state[child.hash].weight = runningWeight
+			}
+		} else {
+			n.state[child.hash].weight -= n.sim.ApproachFactor
+			if n.state[child.hash].weight < 0.0 {
+				n.state[child.hash].weight = 0.0
+			}
+		}
+
+		runningWeight -= n.state[child.hash].weight
+	}
+}
+
+// Sharpens the children's shares of the block's weight: raises each share
+// to the power of 1 + ApproachFactor and normalizes, a softmax of the log
+// shares. Heavier children gain relative to lighter ones, the heaviest
+// most, and a share of 0 stays 0.
+type MultiplicativeUpdateRule struct{}
+
+func (r *MultiplicativeUpdateRule) Name() string {
+	return UPDATE_RULE_MULTIPLICATIVE
+}
+
+func (r *MultiplicativeUpdateRule) AdjustChildren(n *Node, block *BlockRecord) {
+	totalWeight := n.state[block.hash].weight
+	if totalWeight <= 0.0 {
+		return
+	}
+
+	exponent := 1.0 + n.sim.ApproachFactor
+	sharpened := make([]float64, len(block.children))
+	sharpenedSum := 0.0
+	for i, child := range block.children {
+		share := math.Max(n.state[child.hash].weight, 0.0) / totalWeight
+		sharpened[i] = math.Pow(share, exponent)
+		sharpenedSum += sharpened[i]
+	}
+	if sharpenedSum == 0.0 {
+		return
+	}
+
+	// As in the additive rule, the last child gets the rest, so the sum
+	// stays exact:
+	runningWeight := totalWeight
+	for i, child := range block.children {
+		if i == len(block.children)-1 {
+			n.state[child.hash].weight = runningWeight
+		} else {
+			n.state[child.hash].weight = totalWeight * sharpened[i] / sharpenedSum
+		}
+		runningWeight -= n.state[child.hash].weight
+	}
+}
+
+// A child with more than half of the block's weight snaps to all of it,
+// the others to 0. Without a majority the children move as by the
+// additive rule.
+type MajoritySnapUpdateRule struct{}
+
+func (r *MajoritySnapUpdateRule) Name() string {
+	return UPDATE_RULE_MAJORITY_SNAP
+}
+
+func (r *MajoritySnapUpdateRule) AdjustChildren(n *Node, block *BlockRecord) {
+	totalWeight := n.state[block.hash].weight
+
+	for _, child := range block.children {
+		if n.state[child.hash].weight > totalWeight/2.0 {
+			for _, other := range block.children {
+				n.state[other.hash].weight = 0.0
+			}
+			n.state[child.hash].weight = totalWeight
+			return
+		}
+	}
+
+	(&AdditiveUpdateRule{}).AdjustChildren(n, block)
+}
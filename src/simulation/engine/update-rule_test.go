@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"math"
+	"testing"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+func TestUpdateRules_KeepSums(t *testing.T) {
+	for _, updateRule := range []string{UPDATE_RULE_ADDITIVE, UPDATE_RULE_MULTIPLICATIVE, UPDATE_RULE_MAJORITY_SNAP} {
+		for seed := int64(1); seed <= 10; seed++ {
+			sim := newTestSimulation(t, seed, 0.0, TRUST_MODE_UNIFORM, updateRule)
+
+			for _, node := range sim.Nodes {
+				if node.GetUpdateRule().Name() != updateRule {
+					t.Fatal("Node", node.id, "has update rule", node.GetUpdateRule().Name(), "want", updateRule)
+				}
+
+				// Again and again, so that the weights reach 0.0 and 1.0:
+				for round := 0; round < 20; round++ {
+					node.AdjustWeightsTowardsConsensus(sim.RootBlockTree.Root)
+
+					weights := map[cipher.SHA256]float64{}
+					for _, block := range sim.RootBlockTree.GetAllBlockRecords() {
+						weights[block.hash] = node.GetWeight(block.hash)
+						if weights[block.hash] < 0.0 {
+							t.Log(updateRule, "seed", seed, "node", node.id, "negative weight", weights[block.hash])
+							t.Fail()
+						}
+					}
+					for _, err := range sumErrors(sim.RootBlockTree, weights) {
+						if math.Abs(err) > 1e-9 {
+							t.Log(updateRule, "seed", seed, "node", node.id, "round", round, "parent - sum(children) =", err)
+							t.Fail()
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestMajoritySnapUpdateRule_Snaps(t *testing.T) {
+	tests := []struct {
+		weights [3]float64
+		want    [3]float64
+	}{
+		{[3]float64{1, 0.6, 0.4}, [3]float64{1, 1, 0}},
+		{[3]float64{1, 0.3, 0.7}, [3]float64{1, 0, 1}},
+		{[3]float64{0.5, 0.26, 0.24}, [3]float64{0.5, 0.5, 0}}, // Half of the block's weight, not of 1.0
+		// No majority: as by the additive rule, with the approach factor of
+		// 0.1, the first child is not above an even share so moves down
+		{[3]float64{1, 0.5, 0.5}, [3]float64{1, 0.4, 0.6}},
+	}
+
+	for _, test := range tests {
+		sim := newFixtureSimulation(t, [][3]float64{test.weights, test.weights, test.weights})
+		sim.ApproachFactor = 0.1
+		node := sim.Nodes[0]
+
+		(&MajoritySnapUpdateRule{}).AdjustChildren(node, sim.RootBlockTree.Root)
+
+		for i, block := range sim.RootBlockTree.GetAllBlockRecords() {
+			if math.Abs(node.GetWeight(block.hash)-test.want[i]) > 1e-12 {
+				t.Log("Weights", test.weights, "block", i, "got", node.GetWeight(block.hash), "want", test.want[i])
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestMultiplicativeUpdateRule_Sharpens(t *testing.T) {
+	sim := newFixtureSimulation(t, [][3]float64{{1, 0.6, 0.4}, {1, 0.6, 0.4}, {1, 0.6, 0.4}})
+	sim.ApproachFactor = 0.5
+	node := sim.Nodes[0]
+	leaves := sim.RootBlockTree.Root.children
+
+	(&MultiplicativeUpdateRule{}).AdjustChildren(node, sim.RootBlockTree.Root)
+
+	heavy, light := math.Pow(0.6, 1.5), math.Pow(0.4, 1.5)
+	want := heavy / (heavy + light)
+	if math.Abs(node.GetWeight(leaves[0].hash)-want) > 1e-12 || math.Abs(node.GetWeight(leaves[1].hash)-(1.0-want)) > 1e-12 {
+		t.Log("Leaves got", node.GetWeight(leaves[0].hash), node.GetWeight(leaves[1].hash), "want", want, 1.0-want)
+		t.Fail()
+	}
+	if want <= 0.6 {
+		t.Fatal("The heavier leaf did not gain")
+	}
+}
@@ -0,0 +1,26 @@
+package engine
+
+import (
+	"math/rand"
+
+	"github.com/skycoin/skycoin/src/cipher"
+)
+
+// Random bytes from the given RNG, so that a seed reproduces them
+func GetRandomBytes(rng *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	rng.Read(b)
+	return b
+}
+
+func GetRandomSHA256(rng *rand.Rand) cipher.SHA256 {
+	return cipher.MustSHA256FromBytes(GetRandomBytes(rng, 32))
+}
+
+// Simulate a random cipher.PubKey
+func GetRandomPubKey(rng *rand.Rand) cipher.PubKey {
+	b := GetRandomBytes(rng, 33)
+	p := cipher.PubKey{}
+	copy(p[:], b[:])
+	return p
+}
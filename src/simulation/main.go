@@ -6,6 +6,10 @@ import (
 	"log"
 	"math/rand"
 	"os"
+	"runtime"
+	"strconv"
+
+	"github.com/adnan-mansoor-2015/obelisk/src/simulation/engine"
 )
 
 const DEFAULT_NODES = 3
@@ -34,6 +38,34 @@ func main() {
 	iterations := flag.Int("iterations", DEFAULT_ITERATIONS, fmt.Sprintf("Number of iterations to run this simulation. Min Value: %d", MIN_ITERATIONS))
 	blockRecordCount := flag.Int("block-record-count", DEFAULT_BLOCK_TREE_BLOCK_RECORD_COUNT, fmt.Sprintf("Total Number of Blocks in Root Block Tree. Min Value: %d", MIN_BLOCK_TREE_BLOCK_RECORD_COUNT))
 	childrenPerBlock := flag.Int("children-per-block", DEFAULT_BLOCK_TREE_CHILDREN_COUNT, fmt.Sprintf("Max Number of Children Per Block in Root Block Tree. Min Value: %d", MIN_BLOCK_TREE_CHILDREN_COUNT))
+	convergenceMode := flag.String("convergence", engine.CONVERGENCE_MODE_WEIGHTS, fmt.Sprintf("Convergence criterion: %s (all nodes give every block the same weight, of 0 or 1) or %s (all nodes follow the same heaviest path to a leaf)",
+		engine.CONVERGENCE_MODE_WEIGHTS, engine.CONVERGENCE_MODE_ARGMAX))
+	epsilon := flag.Float64("epsilon", 0.0, "Weights that differ by at most this much count as the same when checking convergence. Must be in [0, 0.5)")
+	stabilityWindow := flag.Int("stability-window", 1, "Number of consecutive iterations convergence must hold for")
+	approachFactor := flag.Float64("approach-factor", engine.CONSENSUS_APPROACH_FACTOR, "How far a node moves a block's weight towards consensus per update. Must be in (0, 1]")
+	updateRuleName := flag.String("update-rule", engine.UPDATE_RULE_ADDITIVE, fmt.Sprintf("How the nodes move their weights towards consensus: %s (a fixed step of approach-factor), %s (sharpen the shares of a block's weight by the power 1 + approach-factor) or %s (a child with a majority of a block's weight takes all of it, else %s)",
+		engine.UPDATE_RULE_ADDITIVE, engine.UPDATE_RULE_MULTIPLICATIVE, engine.UPDATE_RULE_MAJORITY_SNAP, engine.UPDATE_RULE_ADDITIVE))
+	weightInitFactor := flag.Float64("weight-init-factor", engine.WEIGHT_INIT_FACTOR, "Spread of the initial weights around an even split. Must be in [0, 0.5)")
+	selfWeight := flag.Float64("self-weight", 0.0, "Share of a node's own weight in its new weight, the rest being the subscriber average; damps oscillation. Must be in [0, 1)")
+	trustMode := flag.String("trust", engine.TRUST_MODE_UNIFORM, fmt.Sprintf("How the nodes weigh their subscriptions when averaging: %s (the same), %s (at random, fixed when the topology is built) or %s (by how much they have agreed)",
+		engine.TRUST_MODE_UNIFORM, engine.TRUST_MODE_RANDOM, engine.TRUST_MODE_LEARNED))
+	trustLearningRate := flag.Float64("trust-learning-rate", engine.DefaultTrustModel().LearningRate, fmt.Sprintf("In %s trust mode, how far the trust moves towards the latest agreement per update. Must be in (0, 1]", engine.TRUST_MODE_LEARNED))
+	metricsFile := flag.String("metrics-file", "", "File to write the convergence metrics of every iteration to, as JSON lines in json output mode, else as CSV")
+	outputMode := flag.String("output", engine.OUTPUT_MODE_TEXT, fmt.Sprintf("Output mode: %s, %s (one JSON object per line) or %s. In %s and %s modes every iteration's update is written",
+		engine.OUTPUT_MODE_TEXT, engine.OUTPUT_MODE_JSON, engine.OUTPUT_MODE_CSV, engine.OUTPUT_MODE_JSON, engine.OUTPUT_MODE_CSV))
+
+	// Sweep Arguments
+	sweep := flag.Bool("sweep", false, "Run every combination of the sweep ranges once per seed, and print a summary table per combination instead of the states. A range is a comma separated list of values and start:end[:step] ranges; an empty range sweeps only the value of the single run flag")
+	sweepNodes := flag.String("sweep-nodes", "", "Range of nodes to sweep, e.g. 3:10")
+	sweepSubscribers := flag.String("sweep-subcribers", "", "Range of subscribers to sweep, e.g. 1,2,4")
+	sweepBlockRecordCount := flag.String("sweep-block-record-count", "", "Range of block-record-count to sweep, e.g. 5:20:5")
+	sweepChildrenPerBlock := flag.String("sweep-children-per-block", "", "Range of children-per-block to sweep, e.g. 2:4")
+	sweepApproachFactor := flag.String("sweep-approach-factor", "", "Range of approach-factor to sweep, e.g. 0.05:0.2:0.05")
+	sweepUpdateRule := flag.String("sweep-update-rule", "", "Comma separated update rules to sweep, e.g. additive,multiplicative")
+	sweepWeightInitFactor := flag.String("sweep-weight-init-factor", "", "Range of weight-init-factor to sweep, e.g. 0:0.04:0.01")
+	sweepSelfWeight := flag.String("sweep-self-weight", "", "Range of self-weight to sweep, e.g. 0:0.6:0.2")
+	sweepSeeds := flag.String("sweep-seeds", "", "Range of seeds to run every combination with, e.g. 1:100")
+	parallel := flag.Int("parallel", runtime.NumCPU(), "Number of sweep simulations to run at once")
 
 	flag.Parse()
 
@@ -72,13 +104,124 @@ func main() {
 		os.Exit(1)
 	}
 
-	rand.Seed(*seed)
+	output, err := engine.NewOutput(*outputMode, os.Stdout)
+	if err != nil {
+		log.Printf("Invalid Value for output: %s", err.Error())
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	convergence := engine.ConvergenceCriterion{Mode: *convergenceMode, Epsilon: *epsilon, Window: *stabilityWindow}
+	if err := convergence.Validate(); err != nil {
+		log.Printf("Invalid Value for convergence: %s", err.Error())
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	if *approachFactor <= 0.0 || *approachFactor > 1.0 {
+		log.Printf("Invalid Value for approach-factor: %v (Must be in (0, 1])", *approachFactor)
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	updateRule, err := engine.NewUpdateRule(*updateRuleName)
+	if err != nil {
+		log.Printf("Invalid Value for update-rule: %s", err.Error())
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	if *weightInitFactor < 0.0 || *weightInitFactor >= 0.5 {
+		log.Printf("Invalid Value for weight-init-factor: %v (Must be in [0, 0.5))", *weightInitFactor)
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
 
-	simulation := GetSimulation()
-	simulation.InitSimulation(*blockRecordCount, *childrenPerBlock, *nodeCount, *subscriberCount, *iterations, *verboseMode)
+	if *selfWeight < 0.0 || *selfWeight >= 1.0 {
+		log.Printf("Invalid Value for self-weight: %v (Must be in [0, 1))", *selfWeight)
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	trust := engine.TrustModel{Mode: *trustMode, LearningRate: *trustLearningRate}
+	if err := trust.Validate(); err != nil {
+		log.Printf("Invalid Value for trust: %s", err.Error())
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	if *sweep {
+		err := runSweep(rangeOr(*sweepNodes, strconv.Itoa(*nodeCount)), rangeOr(*sweepSubscribers, strconv.Itoa(*subscriberCount)),
+			rangeOr(*sweepBlockRecordCount, strconv.Itoa(*blockRecordCount)), rangeOr(*sweepChildrenPerBlock, strconv.Itoa(*childrenPerBlock)),
+			rangeOr(*sweepApproachFactor, strconv.FormatFloat(*approachFactor, 'g', -1, 64)), rangeOr(*sweepUpdateRule, *updateRuleName),
+			rangeOr(*sweepWeightInitFactor, strconv.FormatFloat(*weightInitFactor, 'g', -1, 64)), rangeOr(*sweepSelfWeight, strconv.FormatFloat(*selfWeight, 'g', -1, 64)),
+			rangeOr(*sweepSeeds, strconv.FormatInt(*seed, 10)),
+			*iterations, convergence, trust, *parallel, *outputMode)
+		if err != nil {
+			log.Printf("Sweep Failed with Error: %s", err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	simulation := engine.NewSimulation(rand.New(rand.NewSource(*seed)))
+	simulation.Output = output
+	simulation.Convergence = convergence
+	simulation.ApproachFactor = *approachFactor
+	simulation.UpdateRule = updateRule
+	simulation.WeightInitFactor = *weightInitFactor
+	simulation.Trust = trust
+	simulation.SelfWeight = *selfWeight
+	if err := simulation.InitSimulation(*blockRecordCount, *childrenPerBlock, *nodeCount, *subscriberCount, *iterations, *verboseMode); err != nil {
+		fmt.Printf("\nSimulation Initialization Failed with Error: %s\n", err.Error())
+		os.Exit(1)
+	}
 	if err := simulation.RunSimulation(); err != nil {
+		if *outputMode != engine.OUTPUT_MODE_TEXT {
+			// Keep stdout machine-readable:
+			log.Printf("Simulation Failed with Error: %s", err.Error())
+			os.Exit(1)
+		}
 		fmt.Printf("\nSimulation Failed with Error: %s\n", err.Error())
 		simulation.PrintAllNodes()
 		os.Exit(1)
 	}
+
+	if *outputMode != engine.OUTPUT_MODE_TEXT {
+		// The text output ends with the summary, else it goes to stderr:
+		summary := simulation.SummarizeMetrics()
+		summary.Fprint(os.Stderr)
+	}
+
+	if *metricsFile != "" {
+		if err := writeMetricsFile(simulation, *metricsFile, *outputMode); err != nil {
+			log.Printf("Writing metrics failed with Error: %s", err.Error())
+			os.Exit(1)
+		}
+	}
+}
+
+func writeMetricsFile(simulation *engine.Simulation, path string, outputMode string) error {
+	mode := engine.OUTPUT_MODE_CSV
+	if outputMode == engine.OUTPUT_MODE_JSON {
+		mode = engine.OUTPUT_MODE_JSON
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := simulation.WriteMetrics(mode, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// The range if given, else the single value
+func rangeOr(r string, value string) string {
+	if r == "" {
+		return value
+	}
+	return r
 }
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/adnan-mansoor-2015/obelisk/src/simulation/engine"
+)
+
+// The most values one sweep range may have, so that a step such as
+// 0:1:1e-9 is rejected rather than run
+const MAX_SWEEP_RANGE_VALUES = 10000
+
+// The most simulations one sweep may run: combinations times seeds
+const MAX_SWEEP_RUNS = 1000000
+
+// Runs every combination of the ranges once per seed and writes the
+// summary table to stdout. Combinations the single run flags would reject
+// are skipped.
+func runSweep(nodes string, subscribers string, blockRecordCounts string, childrenPerBlock string,
+	approachFactors string, updateRules string, weightInitFactors string, selfWeights string, seeds string, iterations int,
+	convergence engine.ConvergenceCriterion, trust engine.TrustModel, parallel int, outputMode string) error {
+	nodeValues, err := parseIntRange(nodes)
+	if err != nil {
+		return fmt.Errorf("sweep-nodes: %s", err.Error())
+	}
+	subscriberValues, err := parseIntRange(subscribers)
+	if err != nil {
+		return fmt.Errorf("sweep-subcribers: %s", err.Error())
+	}
+	blockRecordCountValues, err := parseIntRange(blockRecordCounts)
+	if err != nil {
+		return fmt.Errorf("sweep-block-record-count: %s", err.Error())
+	}
+	childrenPerBlockValues, err := parseIntRange(childrenPerBlock)
+	if err != nil {
+		return fmt.Errorf("sweep-children-per-block: %s", err.Error())
+	}
+	approachFactorValues, err := parseFloatRange(approachFactors)
+	if err != nil {
+		return fmt.Errorf("sweep-approach-factor: %s", err.Error())
+	}
+	updateRuleValues := strings.Split(updateRules, ",")
+	weightInitFactorValues, err := parseFloatRange(weightInitFactors)
+	if err != nil {
+		return fmt.Errorf("sweep-weight-init-factor: %s", err.Error())
+	}
+	selfWeightValues, err := parseFloatRange(selfWeights)
+	if err != nil {
+		return fmt.Errorf("sweep-self-weight: %s", err.Error())
+	}
+	seedValues, err := parseSeedRange(seeds)
+	if err != nil {
+		return fmt.Errorf("sweep-seeds: %s", err.Error())
+	}
+
+	runCount := 1
+	for _, count := range []int{len(nodeValues), len(subscriberValues), len(blockRecordCountValues),
+		len(childrenPerBlockValues), len(approachFactorValues), len(updateRuleValues), len(weightInitFactorValues),
+		len(selfWeightValues), len(seedValues)} {
+		if runCount > MAX_SWEEP_RUNS/count {
+			return fmt.Errorf("sweep has more than %d runs", MAX_SWEEP_RUNS)
+		}
+		runCount *= count
+	}
+
+	configs := []engine.SweepConfig{}
+	for _, config := range engine.SweepConfigs(nodeValues, subscriberValues, blockRecordCountValues,
+		childrenPerBlockValues, approachFactorValues, updateRuleValues, weightInitFactorValues, selfWeightValues) {
+		if err := checkSweepConfig(config); err != nil {
+			log.Printf("Skipping sweep configuration %+v: %s", config, err.Error())
+			continue
+		}
+		configs = append(configs, config)
+	}
+	if len(configs) == 0 {
+		return fmt.Errorf("no valid sweep configurations")
+	}
+
+	runs := engine.RunSweep(configs, seedValues, iterations, convergence, trust, parallel)
+	for _, run := range runs {
+		if run.Err != nil {
+			log.Printf("Sweep run %+v seed %d Failed with Error: %s", run.Config, run.Seed, run.Err.Error())
+		}
+	}
+
+	return engine.WriteSweepSummaries(outputMode, os.Stdout, engine.SummarizeSweep(runs))
+}
+
+// The checks of the single run flags, for one sweep configuration
+func checkSweepConfig(config engine.SweepConfig) error {
+	if config.Nodes < MIN_NODES {
+		return fmt.Errorf("nodes must be at least %d", MIN_NODES)
+	}
+	if config.Subscribers < MIN_SUBSCRIBERS || config.Subscribers >= config.Nodes {
+		return fmt.Errorf("subscribers must be at least %d and less than nodes", MIN_SUBSCRIBERS)
+	}
+	if config.BlockRecordCount < MIN_BLOCK_TREE_BLOCK_RECORD_COUNT {
+		return fmt.Errorf("block record count must be at least %d", MIN_BLOCK_TREE_BLOCK_RECORD_COUNT)
+	}
+	if config.ChildrenPerBlock < MIN_BLOCK_TREE_CHILDREN_COUNT || config.ChildrenPerBlock >= config.BlockRecordCount {
+		return fmt.Errorf("children per block must be at least %d and less than block record count", MIN_BLOCK_TREE_CHILDREN_COUNT)
+	}
+	if config.ApproachFactor <= 0.0 || config.ApproachFactor > 1.0 {
+		return fmt.Errorf("approach factor must be in (0, 1]")
+	}
+	if _, err := engine.NewUpdateRule(config.UpdateRule); err != nil {
+		return err
+	}
+	if config.WeightInitFactor < 0.0 || config.WeightInitFactor >= 0.5 {
+		return fmt.Errorf("weight init factor must be in [0, 0.5)")
+	}
+	if config.SelfWeight < 0.0 || config.SelfWeight >= 1.0 {
+		return fmt.Errorf("self weight must be in [0, 1)")
+	}
+	return nil
+}
+
+// Parses a comma separated list of values and ranges, as in "3,5,8:12" or
+// "10:50:10"; a range start:end[:step] includes both ends, step defaults to 1.
+// At most MAX_SWEEP_RANGE_VALUES values in all.
+func parseIntRange(s string) ([]int, error) {
+	values := []int{}
+
+	for _, item := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) > 3 {
+			return nil, fmt.Errorf("invalid range %q (must be start:end[:step])", item)
+		}
+
+		bounds := []int{}
+		for _, part := range parts {
+			value, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q in %q", part, s)
+			}
+			bounds = append(bounds, value)
+		}
+
+		if len(bounds) == 1 {
+			bounds = append(bounds, bounds[0])
+		}
+		step := 1
+		if len(bounds) == 3 {
+			step = bounds[2]
+		}
+		if step < 1 || bounds[1] < bounds[0] {
+			return nil, fmt.Errorf("invalid range %q (must have start <= end and step >= 1)", item)
+		}
+		// Unsigned, as end - start may overflow an int:
+		steps := uint64(bounds[1]-bounds[0]) / uint64(step)
+		if steps >= uint64(MAX_SWEEP_RANGE_VALUES-len(values)) {
+			return nil, fmt.Errorf("range %q has too many values (at most %d in all)", item, MAX_SWEEP_RANGE_VALUES)
+		}
+		for i := 0; i <= int(steps); i++ {
+			values = append(values, bounds[0]+i*step)
+		}
+	}
+
+	return values, nil
+}
+
+// As parseIntRange, for float values; a range has no default step, and
+// must have step > 0
+func parseFloatRange(s string) ([]float64, error) {
+	values := []float64{}
+
+	for _, item := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ":")
+		if len(parts) == 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid range %q (must be start:end:step)", item)
+		}
+
+		bounds := []float64{}
+		for _, part := range parts {
+			value, err := strconv.ParseFloat(part, 64)
+			if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+				return nil, fmt.Errorf("invalid value %q in %q", part, s)
+			}
+			bounds = append(bounds, value)
+		}
+
+		if len(bounds) == 1 {
+			if len(values) >= MAX_SWEEP_RANGE_VALUES {
+				return nil, fmt.Errorf("range %q has too many values (at most %d in all)", item, MAX_SWEEP_RANGE_VALUES)
+			}
+			values = append(values, bounds[0])
+			continue
+		}
+		if bounds[2] <= 0.0 || bounds[1] < bounds[0] {
+			return nil, fmt.Errorf("invalid range %q (must have start <= end and step > 0)", item)
+		}
+		// Stepping by multiplication, and allowing for rounding, keeps the
+		// end in the range; rounding the values keeps 0.1:0.3:0.1 at 0.3,
+		// not 0.30000000000000004:
+		steps := math.Floor((bounds[1]-bounds[0])/bounds[2] + 1e-9)
+		if steps >= float64(MAX_SWEEP_RANGE_VALUES-len(values)) {
+			return nil, fmt.Errorf("range %q has too many values (at most %d in all)", item, MAX_SWEEP_RANGE_VALUES)
+		}
+		for i := 0; i <= int(steps); i++ {
+			values = append(values, math.Round((bounds[0]+float64(i)*bounds[2])*1e9)/1e9)
+		}
+	}
+
+	return values, nil
+}
+
+func parseSeedRange(s string) ([]int64, error) {
+	values, err := parseIntRange(s)
+	if err != nil {
+		return nil, err
+	}
+
+	seeds := []int64{}
+	for _, value := range values {
+		seeds = append(seeds, int64(value))
+	}
+	return seeds, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adnan-mansoor-2015/obelisk/src/simulation/engine"
+)
+
+// start, start+1, ..., end
+func intsFrom(start int, end int) []int {
+	values := []int{}
+	for value := start; value <= end; value++ {
+		values = append(values, value)
+	}
+	return values
+}
+
+func TestParseIntRange(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []int // nil if s is invalid
+	}{
+		{"5", []int{5}},
+		{"3,5,8:12", []int{3, 5, 8, 9, 10, 11, 12}},
+		{"10:50:10", []int{10, 20, 30, 40, 50}},
+		{"10:45:10", []int{10, 20, 30, 40}},
+		{" 1:2 , 4", []int{1, 2, 4}},
+		{"-2:2:2", []int{-2, 0, 2}},
+		{"7:7", []int{7}},
+		{"1:10000", intsFrom(1, MAX_SWEEP_RANGE_VALUES)},
+		{"1:10001", nil},
+		{"", nil},
+		{"a", nil},
+		{"1.5", nil},
+		{"1:", nil},
+		{"1:2:3:4", nil},
+		{"5:1", nil},
+		{"1:5:0", nil},
+		{"1:5:-1", nil},
+		{"0:9223372036854775807", nil},
+		{"-9223372036854775808:9223372036854775807:1", nil},
+		{"1:9999,10000", intsFrom(1, MAX_SWEEP_RANGE_VALUES)},
+		{"1:9999,10000,10001", nil},
+		{"1:10000,0", nil},
+	}
+
+	for _, test := range tests {
+		got, err := parseIntRange(test.s)
+		if test.want == nil {
+			if err == nil {
+				t.Log("parseIntRange", test.s, "accepted as", len(got), "values")
+				t.Fail()
+			}
+		} else if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Log("parseIntRange", test.s, "got", got, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestParseFloatRange(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []float64 // nil if s is invalid
+	}{
+		{"0.5", []float64{0.5}},
+		{"0.1:0.3:0.1", []float64{0.1, 0.2, 0.3}},
+		{"0:0.04:0.01", []float64{0, 0.01, 0.02, 0.03, 0.04}},
+		{"0.05:0.2:0.05,0.5", []float64{0.05, 0.1, 0.15, 0.2, 0.5}},
+		{"0:1:0.3", []float64{0, 0.3, 0.6, 0.9}},
+		{"0:1:0.0001", nil}, // 10001 values
+		{"0:1:1e-9", nil},
+		{"0:1e308:1e-308", nil},
+		{"-1e308:1e308:1", nil},
+		{"", nil},
+		{"x", nil},
+		{"0:1", nil},
+		{"0:1:0.1:0.2", nil},
+		{"1:0:0.1", nil},
+		{"0:1:0", nil},
+		{"0:1:-0.1", nil},
+		{"NaN", nil},
+		{"0:Inf:1", nil},
+		{"0:1:NaN", nil},
+	}
+
+	for _, test := range tests {
+		got, err := parseFloatRange(test.s)
+		if test.want == nil {
+			if err == nil {
+				t.Log("parseFloatRange", test.s, "accepted as", len(got), "values")
+				t.Fail()
+			}
+		} else if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Log("parseFloatRange", test.s, "got", got, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestRunSweep_TooManyRuns(t *testing.T) {
+	err := runSweep("3:1000", "1:1000", "5", "2", "0.1", "additive", "0.01", "0", "1:10", 10,
+		engine.DefaultConvergenceCriterion(), engine.DefaultTrustModel(), 1, engine.OUTPUT_MODE_TEXT)
+	if err == nil || !strings.Contains(err.Error(), "runs") {
+		t.Log("runSweep of 10 million runs returned", err)
+		t.Fail()
+	}
+}